@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/davidsbond/kollect/internal/consume"
+)
+
+// consumeCommand returns the command that prints events read from an event bus, using withLogging to configure
+// logging before it runs.
+func consumeCommand(withLogging func(run func(ctx context.Context) error, failure string) func(cmd *cobra.Command, args []string)) *cobra.Command {
+	var (
+		config consume.Config
+		format string
+		gvks   []string
+	)
+
+	run := func(ctx context.Context) error {
+		config.Format = consume.Format(format)
+		config.Output = os.Stdout
+
+		for _, str := range gvks {
+			gvk, err := consume.ParseGroupVersionKind(str)
+			if err != nil {
+				return err
+			}
+
+			config.GroupVersionKinds = append(config.GroupVersionKinds, gvk)
+		}
+
+		consumer, err := consume.New(ctx, config)
+		if err != nil {
+			return fmt.Errorf("failed to create consumer: %w", err)
+		}
+
+		return consumer.Run(ctx)
+	}
+
+	cmd := &cobra.Command{
+		Use:   "consume",
+		Short: "Print events published by kollect to an event bus",
+		Long: "Print events published by kollect to an event bus. Printed events are acknowledged, so a subscription " +
+			"that is not shared with other consumers should be used.",
+		Run: withLogging(run, "Consumer stopped"),
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&config.URL, "url", "", "URL of the event bus subscription to read events from, see documentation for possible values")
+	flags.StringArrayVar(&config.ClaimCheckURLs, "claim-check-url", nil, "URL of a blob storage bucket that events referenced by claim checks may be fetched from. Can be specified multiple times")
+	flags.StringVar(&format, "output", string(consume.FormatHuman), "The format events are printed in, one of human, json or yaml")
+	flags.StringArrayVar(&gvks, "gvk", nil, "Only print events for resources of the given API version and kind, such as apps/v1/Deployment. Can be specified multiple times")
+	flags.StringArrayVar(&config.Namespaces, "namespace", nil, "Only print events for resources within the given namespace. Can be specified multiple times")
+	flags.StringArrayVar(&config.EventTypes, "type", nil, "Only print events of the given type, one of created, updated or deleted. Can be specified multiple times")
+	flags.StringArrayVar(&config.Clusters, "cluster", nil, "Only print events for resources within the given cluster. Can be specified multiple times")
+	flags.IntVar(&config.Count, "count", 0, "The number of events to print before exiting, unlimited when zero")
+	flags.BoolVar(&config.Follow, "follow", false, "If set, wait for new events until interrupted. Otherwise, exit once no events have been received for --idle-timeout")
+	flags.DurationVar(&config.IdleTimeout, "idle-timeout", time.Second*5, "How long to wait for an event before exiting when not using --follow")
+
+	if err := cmd.MarkFlagRequired("url"); err != nil {
+		panic(err)
+	}
+
+	return cmd
+}
@@ -0,0 +1,234 @@
+// Package admin provides the HTTP server used to expose metrics, profiling, status and probe endpoints for the
+// application.
+package admin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+type (
+	// The Server type is an HTTP server that serves administrative endpoints. Probe endpoints can be served on a
+	// separate address to other endpoints, and endpoints can be protected using bearer token or mutual TLS
+	// authentication.
+	Server struct {
+		config Config
+		mux    *http.ServeMux
+		probes *http.ServeMux
+		auth   *authenticator
+
+		server      *http.Server
+		listener    net.Listener
+		probeServer *http.Server
+		probeLis    net.Listener
+	}
+
+	// The Config type describes how the Server listens for and authenticates requests.
+	Config struct {
+		// The address endpoints are served on.
+		Address string
+		// The address probe endpoints are served on. When blank or the same as Address, probes are served on
+		// Address. Probes served on a separate address do not use TLS.
+		ProbeAddress string
+		// The certificate and key files used to serve endpoints on Address using TLS. Both files are reloaded when
+		// they change, so certificates can be rotated without restarting.
+		TLSCertFile string
+		TLSKeyFile  string
+		// The file containing the PEM encoded certificate authorities used to verify client certificates. When set,
+		// protected endpoints can be accessed by clients presenting a certificate signed by one of the authorities.
+		// Requires TLSCertFile and TLSKeyFile.
+		ClientCAFile string
+		// The file containing the bearer token protected endpoints can be accessed with.
+		BearerTokenFile string
+		// How long to wait for in-flight requests to complete when shutting down. Defaults to 10 seconds.
+		ShutdownTimeout time.Duration
+	}
+)
+
+// DefaultAddress is the address endpoints are served on when one is not set.
+const DefaultAddress = ":8081"
+
+const defaultShutdownTimeout = time.Second * 10
+
+// New returns a new instance of the Server type that listens on the configured addresses. Endpoints should be
+// registered before calling Serve.
+func New(config Config) (*Server, error) {
+	if config.Address == "" {
+		config.Address = DefaultAddress
+	}
+
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = defaultShutdownTimeout
+	}
+
+	s := &Server{
+		config: config,
+		mux:    http.NewServeMux(),
+		probes: http.NewServeMux(),
+	}
+
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	s.auth, err = newAuthenticator(config.BearerTokenFile, config.ClientCAFile != "")
+	if err != nil {
+		return nil, err
+	}
+
+	s.listener, err = net.Listen("tcp", config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", config.Address, err)
+	}
+
+	if tlsConfig != nil {
+		s.listener = tls.NewListener(s.listener, tlsConfig)
+	}
+
+	s.server = &http.Server{Handler: s.mux}
+	if !s.separateProbes() {
+		s.probes = s.mux
+		return s, nil
+	}
+
+	s.probeLis, err = net.Listen("tcp", config.ProbeAddress)
+	if err != nil {
+		// The error listening for probes takes precedence over any error closing the other listener.
+		_ = s.listener.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", config.ProbeAddress, err)
+	}
+
+	s.probeServer = &http.Server{Handler: s.probes}
+	return s, nil
+}
+
+// Handle registers the handler for the given pattern. The endpoint can be accessed without authentication.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleProtected registers the handler for the given pattern. If bearer token or mutual TLS authentication is
+// configured, requests must be authenticated to access the endpoint.
+func (s *Server) HandleProtected(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, s.auth.protect(handler))
+}
+
+// HandleProbe registers the handler for the given pattern on the probe address. The endpoint can be accessed without
+// authentication.
+func (s *Server) HandleProbe(pattern string, handler http.Handler) {
+	s.probes.Handle(pattern, handler)
+}
+
+// Addr returns the address endpoints are served on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// ProbeAddr returns the address probe endpoints are served on.
+func (s *Server) ProbeAddr() net.Addr {
+	if s.probeLis == nil {
+		return s.Addr()
+	}
+
+	return s.probeLis.Addr()
+}
+
+// Serve requests until the provided context.Context is cancelled, at which point the Server stops accepting new
+// requests and waits for in-flight requests to complete, up to the configured shutdown timeout.
+func (s *Server) Serve(ctx context.Context) error {
+	grp, ctx := errgroup.WithContext(ctx)
+
+	grp.Go(func() error {
+		return serve(ctx, s.server, s.listener, s.config.ShutdownTimeout)
+	})
+
+	if s.probeServer != nil {
+		grp.Go(func() error {
+			return serve(ctx, s.probeServer, s.probeLis, s.config.ShutdownTimeout)
+		})
+	}
+
+	return grp.Wait()
+}
+
+// serve requests from the listener until the context is cancelled, then gracefully shut down the server.
+func serve(ctx context.Context, svr *http.Server, lis net.Listener, timeout time.Duration) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- svr.Serve(lis)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	// The provided context is already cancelled, so a new one is used to bound the shutdown.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := svr.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down admin server: %w", err)
+	}
+
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) separateProbes() bool {
+	return s.config.ProbeAddress != "" && s.config.ProbeAddress != s.config.Address
+}
+
+// tlsConfig returns the TLS configuration for the Server, or nil if TLS is not configured.
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	switch {
+	case s.config.TLSCertFile == "" && s.config.TLSKeyFile == "" && s.config.ClientCAFile == "":
+		return nil, nil
+	case s.config.TLSCertFile == "" || s.config.TLSKeyFile == "":
+		return nil, errors.New("both a TLS certificate and key are required")
+	}
+
+	reloader, err := newCertReloader(s.config.TLSCertFile, s.config.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.getCertificate,
+	}
+
+	if s.config.ClientCAFile == "" {
+		return config, nil
+	}
+
+	pem, err := os.ReadFile(s.config.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", s.config.ClientCAFile)
+	}
+
+	// Client certificates are optional at the TLS layer so that probes and unprotected endpoints can still be
+	// accessed by clients without one. Protected endpoints check for a verified certificate.
+	config.ClientCAs = pool
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	return config, nil
+}
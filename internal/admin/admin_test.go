@@ -0,0 +1,371 @@
+package admin_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/kollect/internal/admin"
+)
+
+func TestServer_Serve(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0o600))
+
+	tt := []struct {
+		Name           string
+		Config         admin.Config
+		Path           string
+		Probe          bool
+		Token          string
+		ExpectedStatus int
+	}{
+		{
+			Name:           "It should serve unprotected endpoints without authentication",
+			Config:         admin.Config{BearerTokenFile: tokenFile},
+			Path:           "/metrics",
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "It should serve protected endpoints when authentication is not configured",
+			Path:           "/status",
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "It should reject requests to protected endpoints without a token",
+			Config:         admin.Config{BearerTokenFile: tokenFile},
+			Path:           "/status",
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "It should reject requests to protected endpoints with an invalid token",
+			Config:         admin.Config{BearerTokenFile: tokenFile},
+			Path:           "/status",
+			Token:          "invalid",
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "It should serve protected endpoints with a valid token",
+			Config:         admin.Config{BearerTokenFile: tokenFile},
+			Path:           "/status",
+			Token:          "secret",
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "It should serve probes on the same address by default",
+			Path:           "/health",
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "It should serve probes on a separate address",
+			Config:         admin.Config{ProbeAddress: "localhost:0"},
+			Path:           "/health",
+			Probe:          true,
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "It should not serve probes on the main address when using a separate address",
+			Config:         admin.Config{ProbeAddress: "localhost:0"},
+			Path:           "/health",
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Name:           "It should not serve other endpoints on the probe address",
+			Config:         admin.Config{ProbeAddress: "localhost:0"},
+			Path:           "/metrics",
+			Probe:          true,
+			ExpectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			tc.Config.Address = "127.0.0.1:0"
+			svr := newServer(t, tc.Config)
+
+			done := make(chan error, 1)
+			go func() {
+				done <- svr.Serve(ctx)
+			}()
+
+			addr := svr.Addr()
+			if tc.Probe {
+				addr = svr.ProbeAddr()
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr.String()+tc.Path, nil)
+			require.NoError(t, err)
+			if tc.Token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.Token)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, tc.ExpectedStatus, resp.StatusCode)
+
+			cancel()
+			require.NoError(t, <-done)
+		})
+	}
+}
+
+func TestServer_ServeShutdown(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	svr, err := admin.New(admin.Config{Address: "127.0.0.1:0"})
+	require.NoError(t, err)
+
+	// The request is in-flight when the server is shut down, so should be allowed to complete.
+	started := make(chan struct{})
+	svr.Handle("/slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(time.Millisecond * 100)
+	}))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- svr.Serve(ctx)
+	}()
+
+	responses := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + svr.Addr().String() + "/slow")
+		if !assert.NoError(t, err) {
+			responses <- 0
+			return
+		}
+
+		assert.NoError(t, resp.Body.Close())
+		responses <- resp.StatusCode
+	}()
+
+	<-started
+	cancel()
+
+	require.NoError(t, <-done)
+	assert.Equal(t, http.StatusOK, <-responses)
+
+	_, err = net.Dial("tcp", svr.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestServer_ServeTLS(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	ca := newCertificate(t, "ca", nil)
+	server := newCertificate(t, "server", ca)
+	client := newCertificate(t, "client", ca)
+
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	server.write(t, certFile, keyFile)
+	ca.write(t, caFile, filepath.Join(dir, "ca.key"))
+
+	svr := newServer(t, admin.Config{
+		Address:      "127.0.0.1:0",
+		TLSCertFile:  certFile,
+		TLSKeyFile:   keyFile,
+		ClientCAFile: caFile,
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- svr.Serve(ctx)
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	get := func(path string, certs ...tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs, ServerName: "localhost"},
+		}}
+
+		resp, err := client.Get("https://" + svr.Addr().String() + path)
+		if err != nil {
+			return nil, err
+		}
+
+		return resp, resp.Body.Close()
+	}
+
+	t.Run("It should serve unprotected endpoints without a client certificate", func(t *testing.T) {
+		resp, err := get("/metrics")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, server.cert.SerialNumber, resp.TLS.PeerCertificates[0].SerialNumber)
+	})
+
+	t.Run("It should reject requests to protected endpoints without a client certificate", func(t *testing.T) {
+		resp, err := get("/status")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("It should serve protected endpoints with a client certificate", func(t *testing.T) {
+		resp, err := get("/status", client.tls(t))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("It should reload the certificate when it changes", func(t *testing.T) {
+		rotated := newCertificate(t, "server", ca)
+		rotated.write(t, certFile, keyFile)
+
+		// Modification times can have a coarse resolution, so they are set explicitly.
+		future := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(certFile, future, future))
+		require.NoError(t, os.Chtimes(keyFile, future, future))
+
+		resp, err := get("/metrics")
+		require.NoError(t, err)
+		assert.Equal(t, rotated.cert.SerialNumber, resp.TLS.PeerCertificates[0].SerialNumber)
+	})
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	emptyFile := filepath.Join(dir, "empty")
+	require.NoError(t, os.WriteFile(emptyFile, nil, 0o600))
+
+	tt := []struct {
+		Name          string
+		Config        admin.Config
+		ExpectedError string
+	}{
+		{
+			Name:          "It should require a TLS key with a TLS certificate",
+			Config:        admin.Config{TLSCertFile: "tls.crt"},
+			ExpectedError: "both a TLS certificate and key are required",
+		},
+		{
+			Name:          "It should require a TLS certificate when using client certificates",
+			Config:        admin.Config{ClientCAFile: "ca.crt"},
+			ExpectedError: "both a TLS certificate and key are required",
+		},
+		{
+			Name:          "It should reject an empty bearer token",
+			Config:        admin.Config{BearerTokenFile: emptyFile},
+			ExpectedError: "bearer token file " + emptyFile + " is empty",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			tc.Config.Address = "127.0.0.1:0"
+			_, err := admin.New(tc.Config)
+			assert.EqualError(t, err, tc.ExpectedError)
+		})
+	}
+}
+
+// newServer returns a Server with endpoints registered for testing, each of which responds with a 200 status.
+func newServer(t *testing.T, config admin.Config) *admin.Server {
+	t.Helper()
+
+	svr, err := admin.New(config)
+	require.NoError(t, err)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	svr.Handle("/metrics", ok)
+	svr.HandleProtected("/status", ok)
+	svr.HandleProbe("/health", ok)
+	return svr
+}
+
+type certificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newCertificate returns a certificate for localhost signed by the parent, or a self-signed certificate authority
+// if the parent is nil.
+func newCertificate(t *testing.T, name string, parent *certificate) *certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &certificate{cert: cert, key: key, der: der}
+}
+
+func (c *certificate) write(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+
+	key, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0o600))
+}
+
+func (c *certificate) tls(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	return tls.Certificate{
+		Certificate: [][]byte{c.der},
+		PrivateKey:  c.key,
+		Leaf:        c.cert,
+	}
+}
@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// The authenticator type checks that requests to protected endpoints present a valid bearer token or a verified
+// client certificate. When neither is configured, all requests are allowed.
+type authenticator struct {
+	token      []byte
+	clientCert bool
+}
+
+func newAuthenticator(tokenFile string, clientCert bool) (*authenticator, error) {
+	a := &authenticator{clientCert: clientCert}
+	if tokenFile == "" {
+		return a, nil
+	}
+
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bearer token file: %w", err)
+	}
+
+	a.token = bytes.TrimSpace(token)
+	if len(a.token) == 0 {
+		return nil, fmt.Errorf("bearer token file %s is empty", tokenFile)
+	}
+
+	return a, nil
+}
+
+// protect returns an http.Handler that only invokes next for authenticated requests.
+func (a *authenticator) protect(next http.Handler) http.Handler {
+	if a.token == nil && !a.clientCert {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.authenticated(r) {
+			if a.token != nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticated returns true if the request presents a verified client certificate or the bearer token.
+func (a *authenticator) authenticated(r *http.Request) bool {
+	if a.clientCert && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+
+	if a.token == nil {
+		return false
+	}
+
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, prefix) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, prefix)), a.token) == 1
+}
@@ -0,0 +1,74 @@
+package admin
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// The certReloader type loads a TLS certificate and key from disk, reloading them when either file is modified.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mux      sync.Mutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.getCertificate(nil); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// getCertificate implements tls.Config.GetCertificate, returning the current certificate. The files are checked for
+// modifications on each handshake. If reloading fails, the previously loaded certificate continues to be used.
+func (r *certReloader) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	modified, err := r.lastModified()
+	if err != nil && r.cert == nil {
+		return nil, err
+	}
+
+	if err != nil || !modified.After(r.modified) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	switch {
+	case err != nil && r.cert == nil:
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	case err != nil:
+		// The files may be partially written, so the previous certificate is used until both can be loaded.
+		return r.cert, nil
+	}
+
+	r.cert = &cert
+	r.modified = modified
+	return r.cert, nil
+}
+
+// lastModified returns the most recent modification time of the certificate and key files.
+func (r *certReloader) lastModified() (time.Time, error) {
+	var modified time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to stat %s: %w", name, err)
+		}
+
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+
+	return modified, nil
+}
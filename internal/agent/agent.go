@@ -10,15 +10,21 @@ import (
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 
 	"github.com/davidsbond/kollect/internal/event"
+	"github.com/davidsbond/kollect/internal/metrics"
+	"github.com/davidsbond/kollect/internal/tracing"
 	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
 )
 
@@ -26,7 +32,9 @@ type (
 	// The Agent type is responsible for handling changes in resources within a cluster namespace and sending them
 	// to a configured EventWriter.
 	Agent struct {
-		config Config
+		config  Config
+		metrics *agentMetrics
+		tracer  trace.Tracer
 
 		// Flag used to prevent event writing until informer caches are synced.
 		synced bool
@@ -37,6 +45,11 @@ type (
 
 		// Mutex used to get/set the synced flag across multiple goroutines.
 		syncMux *sync.RWMutex
+
+		// The state of each informer and of the EventWriter, used to determine the Agent's health and status.
+		resources []*resourceState
+		writer    writerState
+		statusMux *sync.RWMutex
 	}
 
 	// The Config type describes configuration values that can be set for the Agent.
@@ -54,28 +67,64 @@ type (
 		ClusterID string
 		// The event bus to write events to
 		EventWriter EventWriter
+		// Reports the health of each sink when the EventWriter publishes events to multiple sinks. Sinks are included
+		// in the Agent's status, and those failing for longer than the FailureThreshold make the Agent unhealthy.
+		Sinks SinkStatuser
+		// Determines how the agent's metrics are named and where they are registered. By default, metrics are not
+		// registered.
+		Metrics metrics.Config
+		// The provider used to create spans for resource changes. Defaults to the global trace.TracerProvider.
+		TracerProvider trace.TracerProvider
+		// How long events must continuously fail to be published before the Agent is considered unhealthy. When
+		// zero, the Agent is always considered healthy.
+		FailureThreshold time.Duration
+		// Records Kubernetes events describing informer failures, cache synchronisation and sustained failures to
+		// publish events. No events are recorded if nil.
+		EventRecorder record.EventRecorder
+		// The object Kubernetes events are recorded against, typically the Pod the Agent is running in.
+		EventObject *corev1.ObjectReference
 	}
 
 	// The EventWriter interface describes types that can publish events to an arbitrary event store.
 	EventWriter interface {
 		Write(ctx context.Context, evt event.Event) error
 	}
+
+	// The SinkStatuser interface describes types that report the health of the individual sinks an EventWriter
+	// publishes events to, such as the event.MultiWriter type.
+	SinkStatuser interface {
+		Status() []event.SinkStatus
+	}
 )
 
-// New returns a new instance of the Agent type with a set Config.
-func New(config Config) *Agent {
+// New returns a new instance of the Agent type with a set Config. Returns an error if the agent's metrics cannot
+// be registered.
+func New(config Config) (*Agent, error) {
+	m, err := newAgentMetrics(config.Metrics)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Agent{
 		config:     config,
+		metrics:    m,
+		tracer:     tracing.Tracer(config.TracerProvider),
 		handlerMux: &sync.Mutex{},
 		syncMux:    &sync.RWMutex{},
-	}
+		statusMux:  &sync.RWMutex{},
+	}, nil
 }
 
 var errCacheSyncFailed = errors.New("failed to sync cache")
 
+// The name of the logger used by the Agent.
+const loggerName = "agent"
+
 // Run starts the agent, any detected changes in cluster resources will be sent to the configured EventWriter. Blocks until
 // an error occurs or until the provided context.Context is cancelled.
 func (a *Agent) Run(ctx context.Context) error {
+	ctx = klog.NewContext(ctx, klog.LoggerWithName(klog.FromContext(ctx), loggerName))
+
 	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(a.config.ClusterClient, time.Minute*5, a.config.Namespace, nil)
 	group, ctx := errgroup.WithContext(ctx)
 
@@ -84,7 +133,7 @@ func (a *Agent) Run(ctx context.Context) error {
 		informer := factory.ForResource(rs).Informer()
 		cacheSyncs[i] = informer.HasSynced
 
-		handler := a.informerHandler(ctx, informer)
+		handler := a.informerHandler(ctx, a.addResource(rs, informer))
 		group.Go(handler)
 	}
 
@@ -114,36 +163,46 @@ func (a *Agent) Run(ctx context.Context) error {
 		return errCacheSyncFailed
 	}
 
+	klog.FromContext(ctx).Info("Informer caches synced", "resources", len(a.config.Resources))
+	a.recordNormal(ReasonCachesSynced, "Informer caches synced for %d resources", len(a.config.Resources))
 	return group.Wait()
 }
 
-func (a *Agent) informerHandler(ctx context.Context, informer cache.SharedIndexInformer) func() error {
+func (a *Agent) informerHandler(ctx context.Context, rs *resourceState) func() error {
 	return func() error {
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
 
+		logger := klog.LoggerWithValues(klog.FromContext(ctx), "resource", rs.gvr.String())
+		ctx = klog.NewContext(ctx, logger)
+
+		informer := rs.informer
+		informer.AddEventHandler(rs.countObjects())
 		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-			AddFunc:    a.addHandler(ctx),
-			UpdateFunc: a.updateHandler(ctx),
-			DeleteFunc: a.deleteHandler(ctx),
+			AddFunc:    a.addHandler(ctx, rs),
+			UpdateFunc: a.updateHandler(ctx, rs),
+			DeleteFunc: a.deleteHandler(ctx, rs),
 		})
 		err := informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
 			// If we don't have access to this resource, log and stop the informer so that we don't pollute the logs
 			// doing this over and over again.
-			klog.Errorln(err)
+			logger.Error(err, "Stopping informer after watch failure")
+			a.recordWatchError(rs, err)
+			a.recordWarning(ReasonWatchFailed, "Stopped watching %s: %v", rs.gvr.String(), err)
 			cancel()
 		})
 		if err != nil {
 			return fmt.Errorf("failed to set watch error handler: %w", err)
 		}
 
+		logger.V(2).Info("Starting informer")
 		go informer.Run(ctx.Done())
 		<-ctx.Done()
 		return nil
 	}
 }
 
-func (a *Agent) addHandler(ctx context.Context) func(obj interface{}) {
+func (a *Agent) addHandler(ctx context.Context, rs *resourceState) func(obj interface{}) {
 	return func(obj interface{}) {
 		if !a.Ready() {
 			return
@@ -154,16 +213,21 @@ func (a *Agent) addHandler(ctx context.Context) func(obj interface{}) {
 
 		item, ok := obj.(*unstructured.Unstructured)
 		if !ok {
-			klog.Errorf("item is not *unstructured.Unstructured")
+			klog.FromContext(ctx).Error(nil, "Unexpected object type", "type", fmt.Sprintf("%T", obj))
 			return
 		}
 
+		ctx := contextWithResource(ctx, item)
+		ctx, span := a.startSpan(ctx, "resource created", item)
+		defer span.End()
+
 		uid := string(item.GetUID())
 		gvk := item.GroupVersionKind()
 
 		data, err := item.MarshalJSON()
 		if err != nil {
-			klog.Errorf("failed to marshal resource %s: %v", uid, err)
+			tracing.Fail(span, err)
+			klog.FromContext(ctx).Error(err, "Failed to marshal resource")
 			return
 		}
 
@@ -177,10 +241,11 @@ func (a *Agent) addHandler(ctx context.Context) func(obj interface{}) {
 		evt := event.New(payload,
 			event.WithKey(key),
 			event.WithAppliesAt(item.GetCreationTimestamp().Time),
+			event.WithAttributes(a.attributes(item)),
 		)
 
-		a.writeEvent(ctx, evt)
-		resourceCreated.WithLabelValues(
+		a.writeEvent(ctx, rs, evt)
+		a.metrics.resourceCreated.WithLabelValues(
 			gvk.Group,
 			gvk.Version,
 			gvk.Kind,
@@ -189,7 +254,7 @@ func (a *Agent) addHandler(ctx context.Context) func(obj interface{}) {
 	}
 }
 
-func (a *Agent) updateHandler(ctx context.Context) func(then, now interface{}) {
+func (a *Agent) updateHandler(ctx context.Context, rs *resourceState) func(then, now interface{}) {
 	return func(x, y interface{}) {
 		if !a.Ready() {
 			return
@@ -200,28 +265,34 @@ func (a *Agent) updateHandler(ctx context.Context) func(then, now interface{}) {
 
 		then, ok := x.(*unstructured.Unstructured)
 		if !ok {
-			klog.Errorf("item is not *unstructured.Unstructured")
+			klog.FromContext(ctx).Error(nil, "Unexpected object type", "type", fmt.Sprintf("%T", x))
 			return
 		}
 
 		now, ok := y.(*unstructured.Unstructured)
 		if !ok {
-			klog.Errorf("item is not *unstructured.Unstructured")
+			klog.FromContext(ctx).Error(nil, "Unexpected object type", "type", fmt.Sprintf("%T", y))
 			return
 		}
 
+		ctx := contextWithResource(ctx, now)
+		ctx, span := a.startSpan(ctx, "resource updated", now)
+		defer span.End()
+
 		uid := string(then.GetUID())
 		gvk := then.GroupVersionKind()
 
 		thenData, err := then.MarshalJSON()
 		if err != nil {
-			klog.Errorf("failed to marshal resource %s: %v", uid, err)
+			tracing.Fail(span, err)
+			klog.FromContext(ctx).Error(err, "Failed to marshal resource")
 			return
 		}
 
 		nowData, err := now.MarshalJSON()
 		if err != nil {
-			klog.Errorf("failed to marshal resource %s: %v", uid, err)
+			tracing.Fail(span, err)
+			klog.FromContext(ctx).Error(err, "Failed to marshal resource")
 			return
 		}
 
@@ -236,10 +307,11 @@ func (a *Agent) updateHandler(ctx context.Context) func(then, now interface{}) {
 		evt := event.New(payload,
 			event.WithKey(key),
 			event.WithAppliesAt(time.Now()),
+			event.WithAttributes(a.attributes(now)),
 		)
 
-		a.writeEvent(ctx, evt)
-		resourceUpdated.WithLabelValues(
+		a.writeEvent(ctx, rs, evt)
+		a.metrics.resourceUpdated.WithLabelValues(
 			gvk.Group,
 			gvk.Version,
 			gvk.Kind,
@@ -248,7 +320,7 @@ func (a *Agent) updateHandler(ctx context.Context) func(then, now interface{}) {
 	}
 }
 
-func (a *Agent) deleteHandler(ctx context.Context) func(obj interface{}) {
+func (a *Agent) deleteHandler(ctx context.Context, rs *resourceState) func(obj interface{}) {
 	return func(obj interface{}) {
 		if !a.Ready() {
 			return
@@ -259,10 +331,14 @@ func (a *Agent) deleteHandler(ctx context.Context) func(obj interface{}) {
 
 		item, ok := obj.(*unstructured.Unstructured)
 		if !ok {
-			klog.Errorf("item is not *unstructured.Unstructured")
+			klog.FromContext(ctx).Error(nil, "Unexpected object type", "type", fmt.Sprintf("%T", obj))
 			return
 		}
 
+		ctx := contextWithResource(ctx, item)
+		ctx, span := a.startSpan(ctx, "resource deleted", item)
+		defer span.End()
+
 		gvk := item.GroupVersionKind()
 		uid := string(item.GetUID())
 
@@ -280,10 +356,11 @@ func (a *Agent) deleteHandler(ctx context.Context) func(obj interface{}) {
 		evt := event.New(payload,
 			event.WithKey(key),
 			event.WithAppliesAt(deletionTimestamp),
+			event.WithAttributes(a.attributes(item)),
 		)
 
-		a.writeEvent(ctx, evt)
-		resourceDeleted.WithLabelValues(
+		a.writeEvent(ctx, rs, evt)
+		a.metrics.resourceDeleted.WithLabelValues(
 			gvk.Group,
 			gvk.Version,
 			gvk.Kind,
@@ -292,12 +369,48 @@ func (a *Agent) deleteHandler(ctx context.Context) func(obj interface{}) {
 	}
 }
 
-func (a *Agent) writeEvent(ctx context.Context, evt event.Event) {
-	if err := a.config.EventWriter.Write(ctx, evt); err != nil {
-		klog.Errorf("failed to publish event: %v", err)
+// attributes returns the event attributes that describe the given resource.
+func (a *Agent) attributes(item *unstructured.Unstructured) map[string]string {
+	gvk := item.GroupVersionKind()
+
+	return map[string]string{
+		event.AttributeClusterID: a.config.ClusterID,
+		event.AttributeGroup:     gvk.Group,
+		event.AttributeVersion:   gvk.Version,
+		event.AttributeKind:      gvk.Kind,
+		event.AttributeNamespace: item.GetNamespace(),
+		event.AttributeName:      item.GetName(),
+		event.AttributeLabels:    labels.Set(item.GetLabels()).String(),
 	}
 }
 
+func (a *Agent) writeEvent(ctx context.Context, rs *resourceState, evt event.Event) {
+	logger := klog.FromContext(ctx).WithValues("event", evt.ID, "type", evt.Type())
+
+	err := a.config.EventWriter.Write(ctx, evt)
+	a.recordPublish(rs, err)
+	if err != nil {
+		tracing.Fail(trace.SpanFromContext(ctx), err)
+		logger.Error(err, "Failed to publish event")
+		return
+	}
+
+	logger.V(4).Info("Published event")
+}
+
+// contextWithResource returns a context whose logger describes the resource, so that entries logged while handling
+// a change to the resource identify it.
+func contextWithResource(ctx context.Context, item *unstructured.Unstructured) context.Context {
+	logger := klog.LoggerWithValues(klog.FromContext(ctx),
+		"object", klog.KObj(item),
+		"apiVersion", item.GetAPIVersion(),
+		"kind", item.GetKind(),
+		"uid", item.GetUID(),
+	)
+
+	return klog.NewContext(ctx, logger)
+}
+
 // Ready returns true if the Agent's informer caches are synchronised.
 func (a *Agent) Ready() bool {
 	a.syncMux.RLock()
@@ -47,8 +47,13 @@ func TestMain(m *testing.M) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	ag, err := agent.New(cnf)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	go func() {
-		if err := agent.New(cnf).Run(ctx); err != nil {
+		if err := ag.Run(ctx); err != nil {
 			log.Fatalln(err)
 		}
 	}()
@@ -0,0 +1,38 @@
+package agent
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Constants for the reasons of Kubernetes events recorded by the Agent.
+const (
+	// ReasonWatchFailed is the reason for events recorded when an informer stops watching a resource, such as when
+	// the Agent lacks permission to list or watch it.
+	ReasonWatchFailed = "WatchFailed"
+	// ReasonCachesSynced is the reason for events recorded when the initial informer caches are synchronised.
+	ReasonCachesSynced = "CachesSynced"
+	// ReasonPublishFailing is the reason for events recorded when events have continuously failed to be published
+	// for longer than the failure threshold.
+	ReasonPublishFailing = "PublishFailing"
+	// ReasonPublishRecovered is the reason for events recorded when events are published successfully after
+	// ReasonPublishFailing was recorded.
+	ReasonPublishRecovered = "PublishRecovered"
+)
+
+// recordEvent records a Kubernetes event against the configured object. No event is recorded if either the
+// recorder or object are not configured.
+func (a *Agent) recordEvent(eventType, reason, messageFmt string, args ...interface{}) {
+	if a.config.EventRecorder == nil || a.config.EventObject == nil {
+		return
+	}
+
+	a.config.EventRecorder.Eventf(a.config.EventObject, eventType, reason, messageFmt, args...)
+}
+
+func (a *Agent) recordWarning(reason, messageFmt string, args ...interface{}) {
+	a.recordEvent(corev1.EventTypeWarning, reason, messageFmt, args...)
+}
+
+func (a *Agent) recordNormal(reason, messageFmt string, args ...interface{}) {
+	a.recordEvent(corev1.EventTypeNormal, reason, messageFmt, args...)
+}
@@ -0,0 +1,108 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/davidsbond/kollect/internal/agent"
+)
+
+func TestAgent_RecordEvents(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	gvr := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		gvr: "UnstructuredList",
+	})
+
+	writer := &FailingEventWriter{err: errors.New("unreachable")}
+	recorder := record.NewFakeRecorder(10)
+
+	ag, err := agent.New(agent.Config{
+		Namespace:        "namespace",
+		EventWriter:      writer,
+		ClusterClient:    client,
+		ClusterID:        "test",
+		Resources:        []schema.GroupVersionResource{gvr},
+		WaitForCacheSync: true,
+		FailureThreshold: time.Millisecond * 100,
+		EventRecorder:    recorder,
+		EventObject: &corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Namespace:  "namespace",
+			Name:       "kollect",
+		},
+	})
+	require.NoError(t, err)
+
+	go func() {
+		assert.NoError(t, ag.Run(ctx))
+	}()
+
+	assertEvent(t, recorder, corev1.EventTypeNormal, agent.ReasonCachesSynced)
+
+	create := func(name string) {
+		_, err := client.Resource(gvr).Namespace("namespace").Create(ctx, &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata": map[string]interface{}{
+					"name":      name,
+					"namespace": "namespace",
+					"uid":       name,
+				},
+			},
+		}, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	// A single failure should not record an event, only failures that last longer than the threshold.
+	create("first")
+	require.Eventually(t, func() bool {
+		return !ag.Status().Writer.Connected
+	}, time.Second*10, time.Millisecond*10)
+	assert.Empty(t, recorder.Events)
+
+	time.Sleep(time.Millisecond * 100)
+	create("second")
+	assertEvent(t, recorder, corev1.EventTypeWarning, agent.ReasonPublishFailing)
+
+	// Further failures should not record additional events, so the next event recorded is the recovery.
+	create("third")
+	require.Eventually(t, func() bool {
+		status := ag.Status()
+		return len(status.Resources) == 1 && status.Resources[0].LastEvent != nil && status.Resources[0].Objects == 3
+	}, time.Second*10, time.Millisecond*10)
+
+	writer.SetError(nil)
+	create("fourth")
+	assertEvent(t, recorder, corev1.EventTypeNormal, agent.ReasonPublishRecovered)
+}
+
+func assertEvent(t *testing.T, recorder *record.FakeRecorder, eventType, reason string) {
+	t.Helper()
+
+	select {
+	case evt := <-recorder.Events:
+		assert.Contains(t, evt, fmt.Sprintf("%s %s ", eventType, reason))
+	case <-time.After(time.Second * 10):
+		assert.Fail(t, "timed out waiting for event", "%s %s", eventType, reason)
+	}
+}
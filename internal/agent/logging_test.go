@@ -0,0 +1,94 @@
+package agent_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/klog/v2"
+
+	"github.com/davidsbond/kollect/internal/agent"
+)
+
+func TestAgent_RunLogger(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mux     sync.Mutex
+		entries []string
+	)
+
+	logger := funcr.New(func(prefix, args string) {
+		mux.Lock()
+		defer mux.Unlock()
+		if strings.Contains(args, `"msg"="Published event"`) {
+			entries = append(entries, args)
+		}
+	}, funcr.Options{Verbosity: 4})
+
+	gvr := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		gvr: "UnstructuredList",
+	})
+
+	writer := &MockEventWriter{emitted: make(chan bool, 2)}
+	ag, err := agent.New(agent.Config{
+		Namespace:        "namespace",
+		EventWriter:      writer,
+		ClusterClient:    client,
+		ClusterID:        "test",
+		Resources:        []schema.GroupVersionResource{gvr},
+		WaitForCacheSync: true,
+	})
+	require.NoError(t, err)
+
+	go func() {
+		assert.NoError(t, ag.Run(klog.NewContext(ctx, logger)))
+	}()
+
+	require.Eventually(t, ag.Ready, time.Second*10, time.Millisecond*10)
+
+	for _, name := range []string{"first", "second"} {
+		_, err = client.Resource(gvr).Namespace("namespace").Create(ctx, &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata": map[string]interface{}{
+					"name":      name,
+					"namespace": "namespace",
+					"uid":       name,
+				},
+			},
+		}, metav1.CreateOptions{})
+		require.NoError(t, err)
+		writer.Wait()
+	}
+
+	require.Eventually(t, func() bool {
+		mux.Lock()
+		defer mux.Unlock()
+		return len(entries) == 2
+	}, time.Second*10, time.Millisecond*10)
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	// Each entry should only describe the resource it was logged for, not those handled before it.
+	for i, name := range []string{"first", "second"} {
+		assert.Equal(t, 1, strings.Count(entries[i], `"uid"=`), entries[i])
+		assert.Contains(t, entries[i], `"uid"="`+name+`"`)
+	}
+}
@@ -2,40 +2,41 @@ package agent
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
-)
 
-const (
-	namespace = "kollect"
-	subsystem = "resource"
+	"github.com/davidsbond/kollect/internal/metrics"
 )
 
-func init() {
-	prometheus.MustRegister(
-		resourceCreated,
-		resourceUpdated,
-		resourceDeleted,
-	)
+const subsystem = "resource"
+
+// The agentMetrics type contains the prometheus metrics recorded by an Agent.
+type agentMetrics struct {
+	resourceCreated *prometheus.CounterVec
+	resourceUpdated *prometheus.CounterVec
+	resourceDeleted *prometheus.CounterVec
 }
 
-var (
-	resourceCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: namespace,
-		Subsystem: subsystem,
-		Name:      "created_total",
-		Help:      "Total number of resources created",
-	}, []string{"group", "version", "kind", "namespace"})
-
-	resourceUpdated = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: namespace,
-		Subsystem: subsystem,
-		Name:      "updated_total",
-		Help:      "Total number of resources updated",
-	}, []string{"group", "version", "kind", "namespace"})
-
-	resourceDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: namespace,
-		Subsystem: subsystem,
-		Name:      "deleted_total",
-		Help:      "Total number of resources deleted",
-	}, []string{"group", "version", "kind", "namespace"})
-)
+func newAgentMetrics(config metrics.Config) (*agentMetrics, error) {
+	var (
+		m   agentMetrics
+		err error
+	)
+
+	labels := []string{"group", "version", "kind", "namespace"}
+
+	m.resourceCreated, err = config.NewCounterVec(subsystem, "created_total", "Total number of resources created", labels)
+	if err != nil {
+		return nil, err
+	}
+
+	m.resourceUpdated, err = config.NewCounterVec(subsystem, "updated_total", "Total number of resources updated", labels)
+	if err != nil {
+		return nil, err
+	}
+
+	m.resourceDeleted, err = config.NewCounterVec(subsystem, "deleted_total", "Total number of resources deleted", labels)
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
@@ -2,6 +2,7 @@ package agent_test
 
 import (
 	"context"
+	"sync"
 
 	"github.com/davidsbond/kollect/internal/event"
 )
@@ -25,3 +26,41 @@ func (m *MockEventWriter) Wait() {
 	<-m.emitted
 	return
 }
+
+type (
+	FailingEventWriter struct {
+		mux sync.Mutex
+		err error
+	}
+)
+
+func (m *FailingEventWriter) Write(_ context.Context, _ event.Event) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.err
+}
+
+func (m *FailingEventWriter) SetError(err error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.err = err
+}
+
+type (
+	MockSinks struct {
+		mux      sync.Mutex
+		statuses []event.SinkStatus
+	}
+)
+
+func (m *MockSinks) Status() []event.SinkStatus {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.statuses
+}
+
+func (m *MockSinks) SetStatus(statuses ...event.SinkStatus) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.statuses = statuses
+}
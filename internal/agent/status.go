@@ -0,0 +1,273 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/davidsbond/kollect/internal/event"
+)
+
+type (
+	// The Status type describes the state of the Agent, its informers and its EventWriter.
+	Status struct {
+		// Whether the Agent's informer caches are synchronised, see Agent.Ready.
+		Ready bool `json:"ready"`
+		// Whether the Agent is healthy, see Agent.Healthy.
+		Healthy bool `json:"healthy"`
+		// The reason the Agent is unhealthy, if any.
+		Reason string `json:"reason,omitempty"`
+		// The state of the informer for each watched resource, ordered by group, version and resource.
+		Resources []ResourceStatus `json:"resources"`
+		// The state of the EventWriter.
+		Writer WriterStatus `json:"writer"`
+	}
+
+	// The ResourceStatus type describes the state of the informer for a single resource type.
+	ResourceStatus struct {
+		Group    string `json:"group"`
+		Version  string `json:"version"`
+		Resource string `json:"resource"`
+		// Whether the informer's cache has synchronised.
+		Synced bool `json:"synced"`
+		// The number of objects within the informer's cache.
+		Objects int `json:"objects"`
+		// When an event was last published for a resource of this type, successfully or not.
+		LastEvent *time.Time `json:"lastEvent,omitempty"`
+		// The error returned when last publishing an event for a resource of this type. Cleared once an event is
+		// published successfully.
+		LastError string `json:"lastError,omitempty"`
+		// The error that caused the informer to stop watching the resource, such as a lack of permissions.
+		WatchError string `json:"watchError,omitempty"`
+	}
+
+	// The WriterStatus type describes the state of the EventWriter, based on the outcome of publishing events.
+	WriterStatus struct {
+		// Whether the last event was published successfully. This is true until an event fails to be published.
+		Connected bool `json:"connected"`
+		// When an event was last published successfully.
+		LastPublish *time.Time `json:"lastPublish,omitempty"`
+		// The error returned when an event last failed to be published.
+		LastError string `json:"lastError,omitempty"`
+		// When an event last failed to be published.
+		LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+		// When events started to continuously fail to be published. Cleared once an event is published
+		// successfully.
+		FailingSince *time.Time `json:"failingSince,omitempty"`
+		// The health of each sink events are published to, if the EventWriter publishes to multiple sinks. A sink
+		// can fail while events are still published to the others.
+		Sinks []event.SinkStatus `json:"sinks,omitempty"`
+	}
+
+	// The resourceState type tracks the informer and publishing outcomes for a single resource type.
+	resourceState struct {
+		gvr        schema.GroupVersionResource
+		informer   cache.SharedIndexInformer
+		lastEvent  time.Time
+		lastError  error
+		watchError error
+
+		// The number of objects known to the informer, updated using atomic operations so that Status does not
+		// need to list the informer's store.
+		objects int64
+	}
+
+	// The writerState type tracks the outcomes of publishing events using the EventWriter.
+	writerState struct {
+		lastPublish   time.Time
+		lastError     error
+		lastErrorTime time.Time
+		failingSince  time.Time
+		// Whether a Kubernetes event has been recorded for the current failures.
+		reported bool
+	}
+)
+
+// Status returns the current state of the Agent. Resources are only included once Run has been called.
+func (a *Agent) Status() Status {
+	a.statusMux.RLock()
+	defer a.statusMux.RUnlock()
+
+	status := Status{
+		Ready:     a.Ready(),
+		Resources: make([]ResourceStatus, 0, len(a.resources)),
+		Writer: WriterStatus{
+			Connected:     a.writer.failingSince.IsZero(),
+			LastPublish:   timePtr(a.writer.lastPublish),
+			LastError:     errString(a.writer.lastError),
+			LastErrorTime: timePtr(a.writer.lastErrorTime),
+			FailingSince:  timePtr(a.writer.failingSince),
+		},
+	}
+
+	if a.config.Sinks != nil {
+		status.Writer.Sinks = a.config.Sinks.Status()
+	}
+
+	if err := a.healthy(); err != nil {
+		status.Reason = err.Error()
+	} else {
+		status.Healthy = true
+	}
+
+	for _, rs := range a.resources {
+		status.Resources = append(status.Resources, ResourceStatus{
+			Group:      rs.gvr.Group,
+			Version:    rs.gvr.Version,
+			Resource:   rs.gvr.Resource,
+			Synced:     rs.informer.HasSynced(),
+			Objects:    int(atomic.LoadInt64(&rs.objects)),
+			LastEvent:  timePtr(rs.lastEvent),
+			LastError:  errString(rs.lastError),
+			WatchError: errString(rs.watchError),
+		})
+	}
+
+	sort.Slice(status.Resources, func(i, j int) bool {
+		x, y := status.Resources[i], status.Resources[j]
+		switch {
+		case x.Group != y.Group:
+			return x.Group < y.Group
+		case x.Version != y.Version:
+			return x.Version < y.Version
+		default:
+			return x.Resource < y.Resource
+		}
+	})
+
+	return status
+}
+
+// Healthy returns a non-nil error if events have continuously failed to be published, either at all or to any
+// individual sink, for longer than the configured failure threshold. The Agent is always considered healthy if no
+// threshold is configured.
+func (a *Agent) Healthy() error {
+	a.statusMux.RLock()
+	defer a.statusMux.RUnlock()
+
+	return a.healthy()
+}
+
+func (a *Agent) healthy() error {
+	if a.config.FailureThreshold <= 0 {
+		return nil
+	}
+
+	if !a.writer.failingSince.IsZero() {
+		failing := time.Since(a.writer.failingSince)
+		if failing >= a.config.FailureThreshold {
+			return fmt.Errorf("events have failed to be published for %s: %v", failing.Round(time.Second), a.writer.lastError)
+		}
+	}
+
+	if a.config.Sinks == nil {
+		return nil
+	}
+
+	for _, sink := range a.config.Sinks.Status() {
+		if sink.FailingSince.IsZero() {
+			continue
+		}
+
+		failing := time.Since(sink.FailingSince)
+		if failing >= a.config.FailureThreshold {
+			return fmt.Errorf("events have failed to be published to sink %s for %s: %s", sink.Name, failing.Round(time.Second), sink.LastError)
+		}
+	}
+
+	return nil
+}
+
+// addResource starts tracking the state of the informer for the resource.
+func (a *Agent) addResource(gvr schema.GroupVersionResource, informer cache.SharedIndexInformer) *resourceState {
+	a.statusMux.Lock()
+	defer a.statusMux.Unlock()
+
+	rs := &resourceState{gvr: gvr, informer: informer}
+	a.resources = append(a.resources, rs)
+	return rs
+}
+
+// countObjects returns handlers that track the number of objects known to the informer. They are registered
+// separately from those publishing events, so that objects are counted before the Agent is ready.
+func (rs *resourceState) countObjects() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) {
+			atomic.AddInt64(&rs.objects, 1)
+		},
+		DeleteFunc: func(interface{}) {
+			atomic.AddInt64(&rs.objects, -1)
+		},
+	}
+}
+
+// recordPublish records the outcome of publishing an event for a resource. A Kubernetes event is recorded when
+// events have continuously failed to be published for longer than the failure threshold, and again once they
+// recover.
+func (a *Agent) recordPublish(rs *resourceState, err error) {
+	a.statusMux.Lock()
+
+	now := time.Now()
+	rs.lastEvent = now
+	rs.lastError = err
+
+	if err == nil {
+		recovered := a.writer.reported
+		failing := now.Sub(a.writer.failingSince)
+
+		a.writer.lastPublish = now
+		a.writer.failingSince = time.Time{}
+		a.writer.reported = false
+		a.statusMux.Unlock()
+
+		if recovered {
+			a.recordNormal(ReasonPublishRecovered, "Events are being published again after failing for %s", failing.Round(time.Second))
+		}
+		return
+	}
+
+	a.writer.lastError = err
+	a.writer.lastErrorTime = now
+	if a.writer.failingSince.IsZero() {
+		a.writer.failingSince = now
+	}
+
+	failing := now.Sub(a.writer.failingSince)
+	report := !a.writer.reported && a.config.FailureThreshold > 0 && failing >= a.config.FailureThreshold
+	if report {
+		a.writer.reported = true
+	}
+	a.statusMux.Unlock()
+
+	if report {
+		a.recordWarning(ReasonPublishFailing, "Events have failed to be published for %s: %v", failing.Round(time.Second), err)
+	}
+}
+
+// recordWatchError records the error that caused the informer for a resource to stop.
+func (a *Agent) recordWatchError(rs *resourceState, err error) {
+	a.statusMux.Lock()
+	defer a.statusMux.Unlock()
+
+	rs.watchError = err
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,145 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+
+	"github.com/davidsbond/kollect/internal/agent"
+	"github.com/davidsbond/kollect/internal/event"
+)
+
+func TestAgent_Status(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	gvr := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	// Objects that exist before the agent is ready should still be counted.
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		gvr: "UnstructuredList",
+	}, &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":      "existing",
+				"namespace": "namespace",
+				"uid":       "existing",
+			},
+		},
+	})
+
+	ag, err := agent.New(agent.Config{
+		Namespace:        "namespace",
+		EventWriter:      &FailingEventWriter{err: errors.New("unreachable")},
+		ClusterClient:    client,
+		ClusterID:        "test",
+		Resources:        []schema.GroupVersionResource{gvr},
+		WaitForCacheSync: true,
+		FailureThreshold: time.Millisecond * 100,
+	})
+	require.NoError(t, err)
+
+	// The agent should be healthy before any events have been published.
+	require.NoError(t, ag.Healthy())
+	assert.True(t, ag.Status().Healthy)
+	assert.True(t, ag.Status().Writer.Connected)
+
+	go func() {
+		assert.NoError(t, ag.Run(ctx))
+	}()
+
+	require.Eventually(t, ag.Ready, time.Second*10, time.Millisecond*10)
+
+	_, err = client.Resource(gvr).Namespace("namespace").Create(ctx, &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":      "example",
+				"namespace": "namespace",
+				"uid":       "test",
+			},
+		},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	// Publishing should fail without making the agent unhealthy until the threshold is reached.
+	require.Eventually(t, func() bool {
+		return !ag.Status().Writer.Connected
+	}, time.Second*10, time.Millisecond*10)
+
+	require.Eventually(t, func() bool {
+		return ag.Healthy() != nil
+	}, time.Second*10, time.Millisecond*10)
+
+	status := ag.Status()
+	assert.True(t, status.Ready)
+	assert.False(t, status.Healthy)
+	assert.Contains(t, status.Reason, "unreachable")
+	assert.Equal(t, "unreachable", status.Writer.LastError)
+	assert.NotNil(t, status.Writer.FailingSince)
+	assert.Nil(t, status.Writer.LastPublish)
+
+	require.Len(t, status.Resources, 1)
+	resource := status.Resources[0]
+	assert.Equal(t, "apps", resource.Group)
+	assert.Equal(t, "v1", resource.Version)
+	assert.Equal(t, "deployments", resource.Resource)
+	assert.True(t, resource.Synced)
+	assert.Equal(t, 2, resource.Objects)
+	assert.NotNil(t, resource.LastEvent)
+	assert.Equal(t, "unreachable", resource.LastError)
+
+	require.NoError(t, client.Resource(gvr).Namespace("namespace").Delete(ctx, "example", metav1.DeleteOptions{}))
+	assert.Eventually(t, func() bool {
+		return ag.Status().Resources[0].Objects == 1
+	}, time.Second*10, time.Millisecond*10)
+}
+
+func TestAgent_StatusSinks(t *testing.T) {
+	t.Parallel()
+
+	sinks := &MockSinks{}
+	ag, err := agent.New(agent.Config{
+		Namespace:        "namespace",
+		EventWriter:      &FailingEventWriter{},
+		Sinks:            sinks,
+		ClusterID:        "test",
+		FailureThreshold: time.Minute,
+	})
+	require.NoError(t, err)
+
+	healthy := event.SinkStatus{Name: "mem://healthy", Healthy: true, LastWrite: time.Now()}
+	failing := event.SinkStatus{Name: "mem://failing", LastError: "unreachable", LastErrorTime: time.Now(), FailingSince: time.Now()}
+
+	// A sink failing for less than the threshold should be reported without making the agent unhealthy.
+	sinks.SetStatus(healthy, failing)
+	require.NoError(t, ag.Healthy())
+
+	status := ag.Status()
+	assert.True(t, status.Healthy)
+	assert.True(t, status.Writer.Connected)
+	assert.Equal(t, []event.SinkStatus{healthy, failing}, status.Writer.Sinks)
+
+	failing.FailingSince = time.Now().Add(-time.Hour)
+	sinks.SetStatus(healthy, failing)
+	require.Error(t, ag.Healthy())
+
+	status = ag.Status()
+	assert.False(t, status.Healthy)
+	assert.Contains(t, status.Reason, "mem://failing")
+	assert.Contains(t, status.Reason, "unreachable")
+	assert.True(t, status.Writer.Connected)
+}
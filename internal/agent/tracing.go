@@ -0,0 +1,26 @@
+package agent
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// startSpan starts a span describing a change to the resource. Spans for events written while handling the change
+// are children of this span.
+func (a *Agent) startSpan(ctx context.Context, name string, item *unstructured.Unstructured) (context.Context, trace.Span) {
+	gvk := item.GroupVersionKind()
+
+	return a.tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("kollect.cluster_id", a.config.ClusterID),
+		attribute.String("kollect.resource.group", gvk.Group),
+		attribute.String("kollect.resource.version", gvk.Version),
+		attribute.String("kollect.resource.kind", gvk.Kind),
+		attribute.String("kollect.resource.uid", string(item.GetUID())),
+		attribute.String("kollect.resource.name", item.GetName()),
+		semconv.K8SNamespaceNameKey.String(item.GetNamespace()),
+	))
+}
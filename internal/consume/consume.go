@@ -0,0 +1,306 @@
+// Package consume provides the implementation of a consumer that reads kollect events from an event bus and prints
+// them, to aid in debugging what the agent is publishing.
+package consume
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+
+	"github.com/davidsbond/kollect/internal/event"
+	"github.com/davidsbond/kollect/pkg/kollect"
+)
+
+type (
+	// The Consumer type reads events from an event bus and writes them to an io.Writer in a configured Format.
+	Consumer struct {
+		config  Config
+		handler *kollect.EventHandler
+
+		// Guards the number of events printed and ensures events are written one at a time.
+		mux     *sync.Mutex
+		printed int
+
+		// Stops reading events once enough have been printed or no events have been received for the idle timeout.
+		// Handlers are allowed to finish once reading stops, so done is used to determine whether to print an event.
+		stop context.CancelFunc
+		done <-chan struct{}
+		idle *time.Timer
+	}
+
+	// The Config type describes configuration values that can be set for the Consumer.
+	Config struct {
+		// The URL of the event bus to read events from.
+		URL string
+		// The format events are printed in. Defaults to FormatHuman.
+		Format Format
+		// Where events are printed.
+		Output io.Writer
+		// The URLs of the blob storage buckets events referenced by claim checks may be fetched from.
+		ClaimCheckURLs []string
+		// When set, only events for resources of the given groups, versions and kinds are printed.
+		GroupVersionKinds []schema.GroupVersionKind
+		// When set, only events for resources within the given namespaces are printed.
+		Namespaces []string
+		// When set, only events of the given types are printed, see the kollect.EventType constants for possible
+		// values.
+		EventTypes []string
+		// When set, only events for resources within the given clusters are printed.
+		Clusters []string
+		// The number of events to print before stopping. When zero, events are printed until the Consumer stops for
+		// another reason.
+		Count int
+		// If true, the Consumer waits for new events until the context is cancelled. Otherwise, the Consumer stops
+		// once no events have been printed for the idle timeout.
+		Follow bool
+		// How long to wait for an event before stopping when not following. Defaults to 5 seconds.
+		IdleTimeout time.Duration
+	}
+
+	// The Format type describes how events are printed.
+	Format string
+
+	// The Event type is the printed representation of an event, containing the event's metadata and the resource it
+	// describes.
+	Event struct {
+		ID         string            `json:"id"`
+		Type       string            `json:"type"`
+		Key        string            `json:"key,omitempty"`
+		ClusterID  string            `json:"clusterId"`
+		Timestamp  time.Time         `json:"timestamp"`
+		AppliesAt  time.Time         `json:"appliesAt"`
+		Attributes map[string]string `json:"attributes,omitempty"`
+		UID        string            `json:"uid"`
+		// The resource, this is nil for deleted events.
+		Resource map[string]interface{} `json:"resource,omitempty"`
+		// The resource before it was updated, this is only set for updated events.
+		Previous map[string]interface{} `json:"previous,omitempty"`
+	}
+)
+
+// Constants for supported output formats.
+const (
+	FormatHuman = Format("human")
+	FormatJSON  = Format("json")
+	FormatYAML  = Format("yaml")
+)
+
+const defaultIdleTimeout = time.Second * 5
+
+// errStopped is returned for events handled after the Consumer has stopped, so that they are nacked.
+var errStopped = errors.New("consumer stopped")
+
+// New returns a new instance of the Consumer type that reads events from the event bus described by the Config's URL.
+func New(ctx context.Context, config Config) (*Consumer, error) {
+	switch config.Format {
+	case "":
+		config.Format = FormatHuman
+	case FormatHuman, FormatJSON, FormatYAML:
+	default:
+		return nil, fmt.Errorf("unsupported output format %q", config.Format)
+	}
+
+	for _, typ := range config.EventTypes {
+		switch typ {
+		case kollect.EventTypeCreated, kollect.EventTypeUpdated, kollect.EventTypeDeleted:
+		default:
+			return nil, fmt.Errorf("unsupported event type %q", typ)
+		}
+	}
+
+	if config.Count < 0 {
+		return nil, fmt.Errorf("invalid count %d, must not be negative", config.Count)
+	}
+
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaultIdleTimeout
+	}
+
+	var opts []kollect.Option
+	for _, urlStr := range config.ClaimCheckURLs {
+		opts = append(opts, kollect.WithClaimCheckBucket(urlStr))
+	}
+	if len(config.GroupVersionKinds) > 0 {
+		opts = append(opts, kollect.WithGroupVersionKinds(config.GroupVersionKinds...))
+	}
+	if len(config.Namespaces) > 0 {
+		opts = append(opts, kollect.WithNamespaces(config.Namespaces...))
+	}
+	if len(config.EventTypes) > 0 {
+		opts = append(opts, kollect.WithEventTypes(config.EventTypes...))
+	}
+	if len(config.Clusters) > 0 {
+		opts = append(opts, kollect.WithClusters(config.Clusters...))
+	}
+
+	handler, err := kollect.NewEventHandler(ctx, config.URL, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Consumer{
+		config:  config,
+		handler: handler,
+		mux:     &sync.Mutex{},
+	}
+
+	handler.OnResourceCreated(func(ctx context.Context, clusterID string, obj *unstructured.Unstructured) error {
+		return c.print(newEvent(ctx, clusterID, string(obj.GetUID()), obj, nil))
+	})
+
+	handler.OnResourceUpdated(func(ctx context.Context, clusterID string, then, now *unstructured.Unstructured) error {
+		return c.print(newEvent(ctx, clusterID, string(now.GetUID()), now, then))
+	})
+
+	handler.OnResourceDeleted(func(ctx context.Context, clusterID, resourceUID string) error {
+		return c.print(newEvent(ctx, clusterID, resourceUID, nil, nil))
+	})
+
+	return c, nil
+}
+
+// ParseGroupVersionKind parses a string in the form <apiVersion>/<kind>, such as "apps/v1/Deployment" or "v1/Pod",
+// into a schema.GroupVersionKind.
+func ParseGroupVersionKind(str string) (schema.GroupVersionKind, error) {
+	i := strings.LastIndex(str, "/")
+	if i <= 0 || i == len(str)-1 {
+		return schema.GroupVersionKind{}, fmt.Errorf("%q must be in the form <apiVersion>/<kind>", str)
+	}
+
+	gv, err := schema.ParseGroupVersion(str[:i])
+	if err != nil {
+		return schema.GroupVersionKind{}, fmt.Errorf("failed to parse %q: %w", str, err)
+	}
+
+	return gv.WithKind(str[i+1:]), nil
+}
+
+// Run reads and prints events until the provided context.Context is cancelled, the configured number of events have
+// been printed or, when not following, no events have been printed for the idle timeout. Printed events are
+// acknowledged, so the Consumer should use a subscription that is not shared with other consumers.
+func (c *Consumer) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c.stop, c.done = cancel, ctx.Done()
+	if !c.config.Follow {
+		c.idle = time.AfterFunc(c.config.IdleTimeout, cancel)
+		defer c.idle.Stop()
+	}
+
+	return c.handler.Handle(ctx)
+}
+
+// print writes the event in the configured format. Events handled after the Consumer has stopped are not printed
+// and an error is returned, so that they are nacked rather than acknowledged.
+func (c *Consumer) print(evt Event) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	select {
+	case <-c.done:
+		return errStopped
+	default:
+	}
+
+	if c.idle != nil {
+		c.idle.Reset(c.config.IdleTimeout)
+	}
+
+	if err := c.write(evt); err != nil {
+		return fmt.Errorf("failed to print event %s: %w", evt.ID, err)
+	}
+
+	c.printed++
+	if c.config.Count > 0 && c.printed >= c.config.Count {
+		c.stop()
+	}
+
+	return nil
+}
+
+func (c *Consumer) write(evt Event) error {
+	switch c.config.Format {
+	case FormatJSON:
+		return json.NewEncoder(c.config.Output).Encode(evt)
+	case FormatYAML:
+		data, err := yaml.Marshal(evt)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(c.config.Output, "---\n%s", data)
+		return err
+	default:
+		_, err := fmt.Fprintln(c.config.Output, evt.String())
+		return err
+	}
+}
+
+// String returns a single line describing the event, used by FormatHuman.
+func (e Event) String() string {
+	apiVersion := path.Join(e.Attributes[event.AttributeGroup], e.Attributes[event.AttributeVersion])
+	kind := e.Attributes[event.AttributeKind]
+	namespace := e.Attributes[event.AttributeNamespace]
+	name := e.Attributes[event.AttributeName]
+
+	// Events published without attributes only describe the resource within the payload.
+	if e.Resource != nil {
+		obj := unstructured.Unstructured{Object: e.Resource}
+		apiVersion, kind, namespace, name = obj.GetAPIVersion(), obj.GetKind(), obj.GetNamespace(), obj.GetName()
+	}
+
+	object := path.Join(namespace, name)
+	if object == "" {
+		object = "uid=" + e.UID
+	}
+
+	resource := strings.TrimSpace(apiVersion + " " + kind)
+	if resource == "" {
+		resource = "<unknown>"
+	}
+
+	return fmt.Sprintf("%s %-7s %s %s cluster=%s id=%s",
+		e.AppliesAt.UTC().Format(time.RFC3339),
+		e.Type,
+		resource,
+		object,
+		e.ClusterID,
+		e.ID,
+	)
+}
+
+func newEvent(ctx context.Context, clusterID, uid string, now, then *unstructured.Unstructured) Event {
+	md, _ := kollect.MetadataFromContext(ctx)
+
+	evt := Event{
+		ID:         md.ID,
+		Type:       md.Type,
+		Key:        md.Key,
+		ClusterID:  clusterID,
+		Timestamp:  md.Timestamp,
+		AppliesAt:  md.AppliesAt,
+		Attributes: md.Attributes,
+		UID:        uid,
+	}
+
+	if now != nil {
+		evt.Resource = now.Object
+	}
+
+	if then != nil {
+		evt.Previous = then.Object
+	}
+
+	return evt
+}
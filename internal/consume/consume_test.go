@@ -0,0 +1,289 @@
+package consume_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+
+	"github.com/davidsbond/kollect/internal/consume"
+	"github.com/davidsbond/kollect/internal/event"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+func TestConsumer_Run(t *testing.T) {
+	t.Parallel()
+
+	appliesAt := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	deployment := object(t, "apps/v1", "Deployment", "production", "example")
+	attributes := map[string]string{
+		event.AttributeClusterID: "test",
+		event.AttributeGroup:     "apps",
+		event.AttributeVersion:   "v1",
+		event.AttributeKind:      "Deployment",
+		event.AttributeNamespace: "production",
+		event.AttributeName:      "example",
+	}
+
+	events := []event.Event{
+		event.New(&resource.ResourceCreatedEvent{
+			Uid:       "example",
+			Resource:  deployment,
+			ClusterId: "test",
+		}, event.WithKey("test/example"), event.WithAppliesAt(appliesAt), event.WithAttributes(attributes)),
+		event.New(&resource.ResourceCreatedEvent{
+			Uid:       "pod",
+			Resource:  object(t, "v1", "Pod", "staging", "pod"),
+			ClusterId: "other",
+		}, event.WithAppliesAt(appliesAt)),
+		event.New(&resource.ResourceUpdatedEvent{
+			Uid:       "example",
+			Then:      deployment,
+			Now:       deployment,
+			ClusterId: "test",
+		}, event.WithAppliesAt(appliesAt), event.WithAttributes(attributes)),
+		event.New(&resource.ResourceDeletedEvent{
+			Uid:       "example",
+			ClusterId: "test",
+		}, event.WithAppliesAt(appliesAt), event.WithAttributes(attributes)),
+	}
+
+	// The in-memory event bus does not guarantee the order events are delivered in, so only the printed lines are
+	// compared.
+	tt := []struct {
+		Name     string
+		Config   consume.Config
+		Expected []string
+	}{
+		{
+			Name: "It should print events in the human format",
+			Expected: []string{
+				"2022-05-01T12:00:00Z created apps/v1 Deployment production/example cluster=test id=" + events[0].ID,
+				"2022-05-01T12:00:00Z created v1 Pod staging/pod cluster=other id=" + events[1].ID,
+				"2022-05-01T12:00:00Z updated apps/v1 Deployment production/example cluster=test id=" + events[2].ID,
+				"2022-05-01T12:00:00Z deleted apps/v1 Deployment production/example cluster=test id=" + events[3].ID,
+			},
+		},
+		{
+			Name: "It should only print events matching the filters",
+			Config: consume.Config{
+				GroupVersionKinds: []schema.GroupVersionKind{{Group: "apps", Version: "v1", Kind: "Deployment"}},
+				EventTypes:        []string{"updated", "deleted"},
+			},
+			Expected: []string{
+				"2022-05-01T12:00:00Z updated apps/v1 Deployment production/example cluster=test id=" + events[2].ID,
+				"2022-05-01T12:00:00Z deleted apps/v1 Deployment production/example cluster=test id=" + events[3].ID,
+			},
+		},
+		{
+			Name:   "It should only print events within the given namespaces and clusters",
+			Config: consume.Config{Namespaces: []string{"staging"}, Clusters: []string{"other"}},
+			Expected: []string{
+				"2022-05-01T12:00:00Z created v1 Pod staging/pod cluster=other id=" + events[1].ID,
+			},
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			output := consumeEvents(t, fmt.Sprintf("mem://consume-%d", i), tc.Config, events)
+			assert.ElementsMatch(t, tc.Expected, strings.Split(strings.TrimSpace(output), "\n"))
+		})
+	}
+
+	t.Run("It should stop once the count is reached", func(t *testing.T) {
+		output := consumeEvents(t, "mem://consume-count", consume.Config{Count: 2}, events)
+		assert.Len(t, strings.Split(strings.TrimSpace(output), "\n"), 2)
+	})
+}
+
+func TestConsumer_RunFormats(t *testing.T) {
+	t.Parallel()
+
+	deployment := object(t, "apps/v1", "Deployment", "production", "example")
+	evt := event.New(&resource.ResourceCreatedEvent{
+		Uid:       "example",
+		Resource:  deployment,
+		ClusterId: "test",
+	})
+
+	tt := []struct {
+		Name      string
+		Format    consume.Format
+		Unmarshal func(t *testing.T, output string) consume.Event
+	}{
+		{
+			Name:   "It should print events as JSON lines",
+			Format: consume.FormatJSON,
+			Unmarshal: func(t *testing.T, output string) consume.Event {
+				lines := strings.Split(strings.TrimSpace(output), "\n")
+				require.Len(t, lines, 1)
+
+				var actual consume.Event
+				require.NoError(t, json.Unmarshal([]byte(lines[0]), &actual))
+				return actual
+			},
+		},
+		{
+			Name:   "It should print events as YAML documents",
+			Format: consume.FormatYAML,
+			Unmarshal: func(t *testing.T, output string) consume.Event {
+				require.True(t, strings.HasPrefix(output, "---\n"))
+
+				var actual consume.Event
+				require.NoError(t, yaml.Unmarshal([]byte(strings.TrimPrefix(output, "---\n")), &actual))
+				return actual
+			},
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			output := consumeEvents(t, fmt.Sprintf("mem://consume-format-%d", i), consume.Config{Format: tc.Format}, []event.Event{evt})
+			actual := tc.Unmarshal(t, output)
+
+			assert.Equal(t, evt.ID, actual.ID)
+			assert.Equal(t, event.TypeResourceCreated, actual.Type)
+			assert.Equal(t, "test", actual.ClusterID)
+			assert.Equal(t, "example", actual.UID)
+			assert.True(t, evt.AppliesAt.Equal(actual.AppliesAt))
+			assert.Equal(t, "Deployment", actual.Resource["kind"])
+			assert.Nil(t, actual.Previous)
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name          string
+		Config        consume.Config
+		ExpectedError string
+	}{
+		{
+			Name:          "It should reject unsupported formats",
+			Config:        consume.Config{Format: "xml"},
+			ExpectedError: `unsupported output format "xml"`,
+		},
+		{
+			Name:          "It should reject unsupported event types",
+			Config:        consume.Config{EventTypes: []string{"create"}},
+			ExpectedError: `unsupported event type "create"`,
+		},
+		{
+			Name:          "It should reject a negative count",
+			Config:        consume.Config{Count: -1},
+			ExpectedError: "invalid count -1, must not be negative",
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			tc.Config.URL = fmt.Sprintf("mem://consume-new-%d", i)
+			_, err := consume.New(context.Background(), tc.Config)
+			assert.EqualError(t, err, tc.ExpectedError)
+		})
+	}
+}
+
+func TestParseGroupVersionKind(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name          string
+		Input         string
+		Expected      schema.GroupVersionKind
+		ExpectedError string
+	}{
+		{
+			Name:     "It should parse a kind within a group",
+			Input:    "apps/v1/Deployment",
+			Expected: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		},
+		{
+			Name:     "It should parse a kind within the core group",
+			Input:    "v1/Pod",
+			Expected: schema.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		},
+		{
+			Name:          "It should require a kind",
+			Input:         "apps/v1/",
+			ExpectedError: `"apps/v1/" must be in the form <apiVersion>/<kind>`,
+		},
+		{
+			Name:          "It should require an API version",
+			Input:         "Deployment",
+			ExpectedError: `"Deployment" must be in the form <apiVersion>/<kind>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := consume.ParseGroupVersionKind(tc.Input)
+			if tc.ExpectedError != "" {
+				assert.EqualError(t, err, tc.ExpectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.Expected, actual)
+		})
+	}
+}
+
+// consumeEvents writes the events to the in-memory topic and returns the output of a Consumer that reads them until
+// it is idle.
+func consumeEvents(t *testing.T, url string, config consume.Config, events []event.Event) string {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	// The topic must exist before the subscription is opened.
+	writer, err := event.NewWriter(ctx, url)
+	require.NoError(t, err)
+	defer writer.Close()
+
+	output := &bytes.Buffer{}
+	config.URL = url
+	config.Output = output
+	config.IdleTimeout = time.Millisecond * 250
+
+	consumer, err := consume.New(ctx, config)
+	require.NoError(t, err)
+
+	for _, evt := range events {
+		require.NoError(t, writer.Write(ctx, evt))
+	}
+
+	require.NoError(t, consumer.Run(ctx))
+	require.NoError(t, ctx.Err(), "consumer should stop before the context is cancelled")
+	return output.String()
+}
+
+func object(t *testing.T, apiVersion, kind, namespace, name string) []byte {
+	t.Helper()
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetUID(types.UID(name))
+
+	data, err := obj.MarshalJSON()
+	require.NoError(t, err)
+
+	return data
+}
@@ -0,0 +1,211 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/davidsbond/kollect/internal/tracing"
+)
+
+type (
+	// The BatchHandler type is a function that handles a batch of events. Events are given in the order they were
+	// received. Returning a *BatchError indicates that only some of the events in the batch failed, returning any
+	// other error indicates that the whole batch failed.
+	BatchHandler func(ctx context.Context, events []Event) error
+
+	// The BatchError type is an error returned by a BatchHandler when only some of the events in a batch could not
+	// be handled.
+	BatchError struct {
+		// Errors for each event that could not be handled, keyed by the index of the event within the batch.
+		Errors map[int]error
+	}
+)
+
+// Error returns a description of the failed events, including the error for the first failed event.
+func (e *BatchError) Error() string {
+	indexes := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		indexes = append(indexes, i)
+	}
+
+	if len(indexes) == 0 {
+		return "no events in batch failed"
+	}
+
+	sort.Ints(indexes)
+	return fmt.Sprintf("%d event(s) in batch failed, first error at index %d: %v", len(indexes), indexes[0], e.Errors[indexes[0]])
+}
+
+// ReadBatch reads events from the stream, invoking fn with batches of up to size events. A batch is handed to fn
+// once it contains size events, or once wait has elapsed since its first event was received, whichever comes first.
+// Batches are handled one at a time, so the number of workers set using WithWorkers does not apply.
+//
+// Events in a batch are acknowledged once fn returns nil. If fn returns a *BatchError, the events it does not
+// contain are acknowledged and only the failed events are retried, as a smaller batch. Any other error fails the
+// whole batch. Events that still fail once all attempts are exhausted are handled as described in Read. When the
+// context is cancelled, the batch being handled is given the timeout set using WithDrainTimeout to finish, the events
+// of a batch that is still being accumulated are nacked and nil is returned.
+func (r *Reader) ReadBatch(ctx context.Context, size int, wait time.Duration, fn BatchHandler) error {
+	if size < 1 {
+		return fmt.Errorf("invalid batch size %d, at least one event is required", size)
+	}
+
+	// As in Read, batches are handled using a context that is not cancelled until the drain timeout has elapsed.
+	handlerCtx, cancel := drainContext(ctx, r.drainTimeout)
+	defer cancel()
+
+	for {
+		batch, err := r.batch(ctx, size, wait)
+		if err == nil {
+			err = r.handleBatch(ctx, handlerCtx, batch, fn)
+		} else {
+			r.nackAll(batch)
+		}
+
+		switch {
+		case err == nil:
+			continue
+		case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// batch receives up to size events from the stream. It blocks until the first event is received, then waits up to
+// the given duration for the remaining events.
+func (r *Reader) batch(ctx context.Context, size int, wait time.Duration) ([]delivery, error) {
+	d, err := r.next(ctx, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := []delivery{d}
+
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	for len(batch) < size {
+		d, err = r.next(ctx, waitCtx)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return batch, ctx.Err()
+		case err != nil && waitCtx.Err() != nil:
+			return batch, nil
+		case err != nil:
+			return batch, err
+		}
+
+		batch = append(batch, d)
+	}
+
+	return batch, nil
+}
+
+// handleBatch handles the batch using fn, retrying failed events with an exponential backoff until they succeed, the
+// maximum number of attempts is reached or ctx is cancelled. The batch is handled using handlerCtx.
+func (r *Reader) handleBatch(ctx, handlerCtx context.Context, batch []delivery, fn BatchHandler) error {
+	handlerCtx, span := r.startBatchSpan(handlerCtx, batch)
+	defer span.End()
+
+	backoff := r.backoff
+	pending := batch
+
+	var (
+		attempt int
+		errs    []error
+	)
+
+	for attempt = 1; ; attempt++ {
+		var succeeded []delivery
+		succeeded, pending, errs = attemptBatch(handlerCtx, pending, fn)
+
+		for _, d := range succeeded {
+			d.msg.Ack()
+			r.metrics.consumed(d.evt)
+		}
+
+		if len(pending) == 0 || attempt >= r.maxAttempts || ctx.Err() != nil {
+			break
+		}
+
+		for _, d := range pending {
+			r.metrics.eventsRetried.WithLabelValues(d.evt.typeName()).Inc()
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+
+	if ctx.Err() != nil && len(pending) > 0 {
+		// The reader is stopping, so failed events are nacked to be redelivered rather than treated as failed.
+		r.nackAll(pending)
+		return ctx.Err()
+	}
+
+	for i, d := range pending {
+		err := fmt.Errorf("failed to handle event %s: %w", d.evt.ID, errs[i])
+		tracing.Fail(span, err)
+		if err = r.fail(handlerCtx, d.msg, d.evt, attempt, err); err != nil {
+			r.nackAll(pending[i+1:])
+			return err
+		}
+	}
+
+	return nil
+}
+
+// attemptBatch invokes fn with the events in the batch. Returns the deliveries whose events were handled, and those
+// whose events failed alongside their errors.
+func attemptBatch(ctx context.Context, batch []delivery, fn BatchHandler) ([]delivery, []delivery, []error) {
+	events := make([]Event, len(batch))
+	for i, d := range batch {
+		events[i] = d.evt
+	}
+
+	err := fn(ctx, events)
+	if err == nil {
+		return batch, nil, nil
+	}
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		errs := make([]error, len(batch))
+		for i := range errs {
+			errs[i] = err
+		}
+
+		return nil, batch, errs
+	}
+
+	var (
+		succeeded []delivery
+		failed    []delivery
+		errs      []error
+	)
+
+	for i, d := range batch {
+		if e := batchErr.Errors[i]; e != nil {
+			failed = append(failed, d)
+			errs = append(errs, e)
+			continue
+		}
+
+		succeeded = append(succeeded, d)
+	}
+
+	return succeeded, failed, errs
+}
+
+func (r *Reader) nackAll(batch []delivery) {
+	for _, d := range batch {
+		r.nack(d.msg, d.evt)
+	}
+}
@@ -0,0 +1,104 @@
+package event_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/kollect/internal/event"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+func TestReader_ReadBatch(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	const url = "mem://batch"
+
+	writer, err := event.NewWriter(ctx, url)
+	require.NoError(t, err)
+	defer writer.Close()
+
+	var (
+		events      = make([]event.Event, 5)
+		attempts    = make(map[string]int)
+		handled     = make(map[string]bool)
+		retries     [][]event.Event
+		deadLetters []event.DeadLetter
+	)
+
+	reader, err := event.NewReader(ctx, url,
+		event.WithRetry(2, time.Millisecond),
+		event.WithDeadLetter(func(ctx context.Context, dl event.DeadLetter) error {
+			deadLetters = append(deadLetters, dl)
+			if len(handled) == len(events)-1 {
+				cancel()
+			}
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+
+	// The first event fails once and is then handled, the second event always fails.
+	for i := range events {
+		events[i] = event.New(&resource.ResourceDeletedEvent{Uid: "test", ClusterId: "test"})
+		require.NoError(t, writer.Write(ctx, events[i]))
+	}
+
+	assert.Error(t, reader.ReadBatch(ctx, 0, time.Second, nil))
+
+	err = reader.ReadBatch(ctx, 3, time.Millisecond*100, func(ctx context.Context, batch []event.Event) error {
+		assert.LessOrEqual(t, len(batch), 3)
+
+		batchErr := &event.BatchError{Errors: make(map[int]error)}
+		for i, evt := range batch {
+			attempts[evt.ID]++
+			if attempts[evt.ID] > 1 {
+				retries = append(retries, batch)
+			}
+
+			switch {
+			case evt.ID == events[0].ID && attempts[evt.ID] == 1:
+				batchErr.Errors[i] = errors.New("first attempt")
+			case evt.ID == events[1].ID:
+				batchErr.Errors[i] = errors.New("always")
+			default:
+				handled[evt.ID] = true
+			}
+		}
+
+		if len(handled) == len(events)-1 && len(deadLetters) == 1 {
+			cancel()
+		}
+
+		if len(batchErr.Errors) > 0 {
+			return batchErr
+		}
+
+		return nil
+	})
+
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+
+	// Only the failed events should be retried, and each is retried once.
+	for _, batch := range retries {
+		for _, evt := range batch {
+			assert.Contains(t, []string{events[0].ID, events[1].ID}, evt.ID)
+		}
+	}
+
+	assert.Len(t, handled, 4)
+	assert.False(t, handled[events[1].ID])
+	assert.Equal(t, 2, attempts[events[0].ID])
+	assert.Equal(t, 2, attempts[events[1].ID])
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, events[1].ID, deadLetters[0].EventID)
+	assert.Equal(t, 2, deadLetters[0].Attempts)
+}
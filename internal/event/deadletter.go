@@ -0,0 +1,69 @@
+package event
+
+import (
+	"context"
+	"strconv"
+
+	"gocloud.dev/pubsub"
+)
+
+type (
+	// The DeadLetter type describes a message that could not be decoded or handled by a Reader.
+	DeadLetter struct {
+		// The original body of the message.
+		Body []byte
+		// The original metadata of the message.
+		Metadata map[string]string
+		// The identifier of the event, this is blank if the message could not be decoded.
+		EventID string
+		// The number of times handling the event was attempted.
+		Attempts int
+		// The error returned by the final attempt.
+		Err error
+	}
+
+	// The DeadLetterHandler type is a function that is invoked for messages that could not be decoded or handled.
+	// If the function returns nil, the message is acknowledged.
+	DeadLetterHandler func(ctx context.Context, dl DeadLetter) error
+)
+
+// Metadata keys added to messages forwarded to a dead letter topic.
+const (
+	deadLetterErrorKey    = "dead-letter-error"
+	deadLetterAttemptsKey = "dead-letter-attempts"
+)
+
+// WithDeadLetter returns a ReaderOption that invokes fn for messages that could not be decoded, or whose handler
+// still fails once all attempts are exhausted. Messages are acknowledged once fn returns nil. This option cannot be
+// used alongside WithDeadLetterTopic.
+func WithDeadLetter(fn DeadLetterHandler) ReaderOption {
+	return func(r *Reader) {
+		r.deadLetter = fn
+	}
+}
+
+// WithDeadLetterTopic returns a ReaderOption that forwards messages that could not be decoded, or whose handler
+// still fails once all attempts are exhausted, to the topic identified using the given URL. Messages are forwarded
+// unchanged, other than the addition of metadata describing the error. This option cannot be used alongside
+// WithDeadLetter.
+func WithDeadLetterTopic(urlStr string) ReaderOption {
+	return func(r *Reader) {
+		r.deadLetterURL = urlStr
+	}
+}
+
+// forward a dead letter to the dead letter topic.
+func (r *Reader) forward(ctx context.Context, dl DeadLetter) error {
+	metadata := make(map[string]string, len(dl.Metadata)+2)
+	for k, v := range dl.Metadata {
+		metadata[k] = v
+	}
+
+	metadata[deadLetterErrorKey] = dl.Err.Error()
+	metadata[deadLetterAttemptsKey] = strconv.Itoa(dl.Attempts)
+
+	return r.deadLetterTopic.Send(ctx, &pubsub.Message{
+		Body:     dl.Body,
+		Metadata: metadata,
+	})
+}
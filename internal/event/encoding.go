@@ -0,0 +1,399 @@
+package event
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+
+	"gocloud.dev/pubsub/azuresb"
+	"gocloud.dev/pubsub/kafkapubsub"
+	"gocloud.dev/pubsub/rabbitpubsub"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+type (
+	// The Encoding type describes how events are encoded when they are written to the stream.
+	Encoding string
+
+	// The DataFormat type describes how the payload of an event is encoded when using one of the CloudEvents
+	// encodings.
+	DataFormat string
+)
+
+// Supported values for the Encoding type.
+const (
+	// EncodingProto encodes events as a protobuf envelope. This is the default encoding.
+	EncodingProto Encoding = "proto"
+	// EncodingJSON encodes events as a JSON envelope using the protobuf JSON mapping.
+	EncodingJSON Encoding = "json"
+	// EncodingCloudEventsStructured encodes events as CloudEvents in structured content mode, the message body contains
+	// a JSON-encoded CloudEvent that includes the event payload.
+	EncodingCloudEventsStructured Encoding = "cloudevents-structured"
+	// EncodingCloudEventsBinary encodes events as CloudEvents in binary content mode, CloudEvent attributes are written
+	// to the message metadata and the message body contains only the event payload.
+	EncodingCloudEventsBinary Encoding = "cloudevents-binary"
+)
+
+// Supported values for the DataFormat type.
+const (
+	// DataFormatJSON encodes event payloads as JSON. This is the default data format.
+	DataFormatJSON DataFormat = "json"
+	// DataFormatProto encodes event payloads as binary protobuf.
+	DataFormatProto DataFormat = "proto"
+)
+
+const (
+	cloudEventsSpecVersion = "1.0"
+
+	contentTypeKey             = "content-type"
+	contentTypeCloudEventsJSON = "application/cloudevents+json"
+	contentTypeJSON            = "application/json"
+	contentTypeProto           = "application/protobuf"
+)
+
+// Prefixes of the message metadata keys CloudEvent attributes are written to in binary content mode. Each CloudEvents
+// protocol binding defines its own prefix.
+const (
+	cloudEventsPrefixHTTP  = "ce-"
+	cloudEventsPrefixKafka = "ce_"
+	cloudEventsPrefixAMQP  = "cloudEvents:"
+)
+
+// CloudEvents context attributes, including the extension attributes used to carry Event fields that have no
+// standard CloudEvents equivalent.
+const (
+	ceSpecVersion     = "specversion"
+	ceID              = "id"
+	ceSource          = "source"
+	ceType            = "type"
+	ceSubject         = "subject"
+	ceTime            = "time"
+	ceDataContentType = "datacontenttype"
+	ceDataSchema      = "dataschema"
+	ceData            = "data"
+	ceDataBase64      = "data_base64"
+	ceAppliesAt       = "appliesat"
+	cePartitionKey    = "partitionkey"
+)
+
+// cloudEventTypes maps payload types to their CloudEvents type. Payloads not within this map use their fully
+// qualified protobuf message name as their type.
+var cloudEventTypes = map[protoreflect.FullName]string{
+	(&resource.ResourceCreatedEvent{}).ProtoReflect().Descriptor().FullName(): "io.kollect.resource.created.v1",
+	(&resource.ResourceUpdatedEvent{}).ProtoReflect().Descriptor().FullName(): "io.kollect.resource.updated.v1",
+	(&resource.ResourceDeletedEvent{}).ProtoReflect().Descriptor().FullName(): "io.kollect.resource.deleted.v1",
+}
+
+// cloudEventsPrefixes contains the prefix of each CloudEvents protocol binding, binary CloudEvents are detected using
+// any of them so that events written to one event bus can be forwarded to another.
+var cloudEventsPrefixes = []string{cloudEventsPrefixHTTP, cloudEventsPrefixKafka, cloudEventsPrefixAMQP}
+
+// cloudEventsPrefix returns the prefix used for CloudEvent attributes in binary content mode for the event bus with the
+// given URL scheme. Event buses without their own protocol binding, such as NATS, use the HTTP prefix.
+func cloudEventsPrefix(scheme string) string {
+	switch scheme {
+	case kafkapubsub.Scheme:
+		return cloudEventsPrefixKafka
+	case rabbitpubsub.Scheme, azuresb.Scheme:
+		return cloudEventsPrefixAMQP
+	default:
+		return cloudEventsPrefixHTTP
+	}
+}
+
+func (enc Encoding) valid() bool {
+	switch enc {
+	case EncodingProto, EncodingJSON, EncodingCloudEventsStructured, EncodingCloudEventsBinary:
+		return true
+	default:
+		return false
+	}
+}
+
+func (df DataFormat) valid() bool {
+	switch df {
+	case DataFormatJSON, DataFormatProto:
+		return true
+	default:
+		return false
+	}
+}
+
+// encode the event into a message body and its accompanying metadata using the desired encoding. The data format is
+// only used by the CloudEvents encodings, the prefix only by EncodingCloudEventsBinary.
+func (e Event) encode(enc Encoding, df DataFormat, prefix string) ([]byte, map[string]string, error) {
+	switch enc {
+	case EncodingCloudEventsStructured:
+		return e.encodeCloudEventStructured(df)
+	case EncodingCloudEventsBinary:
+		return e.encodeCloudEventBinary(df, prefix)
+	case EncodingJSON:
+		body, err := e.marshalJSON()
+		return body, map[string]string{contentTypeKey: contentTypeJSON}, err
+	default:
+		// Protobuf envelopes are written without a content type so that their messages remain unchanged for
+		// existing consumers. Some drivers, such as NATS, modify the message body when metadata is present.
+		body, err := e.marshal()
+		return body, nil, err
+	}
+}
+
+// decode an event from a message body and its accompanying metadata, the encoding is determined using the metadata.
+// Messages without a content type are assumed to be protobuf unless their body looks like a JSON object.
+func decode(body []byte, metadata map[string]string) (Event, error) {
+	contentType := metadata[contentTypeKey]
+
+	for _, prefix := range cloudEventsPrefixes {
+		if metadata[prefix+ceSpecVersion] != "" {
+			return decodeCloudEventBinary(body, metadata, prefix)
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(contentType, contentTypeCloudEventsJSON):
+		return decodeCloudEventStructured(body)
+	case strings.HasPrefix(contentType, contentTypeJSON):
+		return unmarshalJSON(body)
+	case contentType == "" && bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")):
+		return unmarshalJSON(body)
+	default:
+		body, err := unframe(body)
+		if err != nil {
+			return Event{}, err
+		}
+
+		return unmarshal(body)
+	}
+}
+
+func (e Event) cloudEventAttributes() map[string]string {
+	attributes := map[string]string{
+		ceSpecVersion: cloudEventsSpecVersion,
+		ceID:          e.ID,
+		ceSource:      e.cloudEventSource(),
+		ceType:        e.cloudEventType(),
+		ceTime:        e.Timestamp.Format(time.RFC3339Nano),
+		ceAppliesAt:   e.AppliesAt.Format(time.RFC3339Nano),
+	}
+
+	if subject := path.Join(e.Attributes[AttributeNamespace], e.Attributes[AttributeName]); subject != "" {
+		attributes[ceSubject] = subject
+	}
+
+	if e.Key != "" {
+		attributes[cePartitionKey] = e.Key
+	}
+
+	// Remaining event attributes are written as extension attributes, they cannot replace any of the attributes
+	// above.
+	for k, v := range e.Attributes {
+		if _, ok := attributes[k]; ok || isCloudEventAttribute(k) {
+			continue
+		}
+
+		attributes[k] = v
+	}
+
+	return attributes
+}
+
+func (e Event) cloudEventSource() string {
+	if clusterID := e.Attributes[AttributeClusterID]; clusterID != "" {
+		return clusterID
+	}
+
+	return "kollect"
+}
+
+func (e Event) cloudEventType() string {
+	name := e.Payload.ProtoReflect().Descriptor().FullName()
+	if typ, ok := cloudEventTypes[name]; ok {
+		return typ
+	}
+
+	return string(name)
+}
+
+func (e Event) cloudEventData(df DataFormat) ([]byte, string, error) {
+	if df == DataFormatProto {
+		data, err := proto.Marshal(e.Payload)
+		return data, contentTypeProto, err
+	}
+
+	data, err := protojson.Marshal(e.Payload)
+	return data, contentTypeJSON, err
+}
+
+func (e Event) encodeCloudEventStructured(df DataFormat) ([]byte, map[string]string, error) {
+	data, contentType, err := e.cloudEventData(df)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ce := make(map[string]interface{})
+	for k, v := range e.cloudEventAttributes() {
+		ce[k] = v
+	}
+
+	ce[ceDataContentType] = contentType
+	if df == DataFormatProto {
+		ce[ceDataBase64] = base64.StdEncoding.EncodeToString(data)
+	} else {
+		ce[ceData] = json.RawMessage(data)
+	}
+
+	body, err := json.Marshal(ce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, map[string]string{contentTypeKey: contentTypeCloudEventsJSON}, nil
+}
+
+func (e Event) encodeCloudEventBinary(df DataFormat, prefix string) ([]byte, map[string]string, error) {
+	data, contentType, err := e.cloudEventData(df)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadata := map[string]string{contentTypeKey: contentType}
+	for k, v := range e.cloudEventAttributes() {
+		metadata[prefix+k] = v
+	}
+
+	return data, metadata, nil
+}
+
+func decodeCloudEventStructured(body []byte) (Event, error) {
+	var ce map[string]json.RawMessage
+	if err := json.Unmarshal(body, &ce); err != nil {
+		return Event{}, err
+	}
+
+	attributes := make(map[string]string)
+	for k, v := range ce {
+		if k == ceData || k == ceDataBase64 {
+			continue
+		}
+
+		var str string
+		if err := json.Unmarshal(v, &str); err != nil {
+			// Extension attributes produced elsewhere may not be strings, in which case we use their JSON
+			// representation.
+			str = string(v)
+		}
+
+		attributes[k] = str
+	}
+
+	var data []byte
+	if encoded, ok := ce[ceDataBase64]; ok {
+		if err := json.Unmarshal(encoded, &data); err != nil {
+			return Event{}, err
+		}
+	} else {
+		data = ce[ceData]
+	}
+
+	return decodeCloudEvent(attributes, data)
+}
+
+func decodeCloudEventBinary(body []byte, metadata map[string]string, prefix string) (Event, error) {
+	attributes := map[string]string{
+		ceDataContentType: metadata[contentTypeKey],
+	}
+
+	for k, v := range metadata {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		attributes[strings.TrimPrefix(k, prefix)] = v
+	}
+
+	return decodeCloudEvent(attributes, body)
+}
+
+func decodeCloudEvent(attributes map[string]string, data []byte) (Event, error) {
+	payload, err := decodeCloudEventData(attributes[ceType], attributes[ceDataContentType], data)
+	if err != nil {
+		return Event{}, err
+	}
+
+	evt := Event{
+		ID:      attributes[ceID],
+		Key:     attributes[cePartitionKey],
+		Payload: payload,
+	}
+
+	if evt.Timestamp, err = parseCloudEventTime(attributes[ceTime]); err != nil {
+		return Event{}, err
+	}
+
+	if evt.AppliesAt, err = parseCloudEventTime(attributes[ceAppliesAt]); err != nil {
+		return Event{}, err
+	}
+
+	for k, v := range attributes {
+		if isCloudEventAttribute(k) {
+			continue
+		}
+
+		if evt.Attributes == nil {
+			evt.Attributes = make(map[string]string)
+		}
+
+		evt.Attributes[k] = v
+	}
+
+	return evt, nil
+}
+
+func decodeCloudEventData(typ, contentType string, data []byte) (proto.Message, error) {
+	name := protoreflect.FullName(typ)
+	for k, v := range cloudEventTypes {
+		if v == typ {
+			name = k
+			break
+		}
+	}
+
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := messageType.New().Interface()
+	if strings.HasPrefix(contentType, contentTypeProto) {
+		err = proto.Unmarshal(data, payload)
+	} else {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, payload)
+	}
+
+	return payload, err
+}
+
+func parseCloudEventTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+func isCloudEventAttribute(name string) bool {
+	switch name {
+	case ceSpecVersion, ceID, ceSource, ceType, ceSubject, ceTime, ceDataContentType, ceDataSchema, ceAppliesAt, cePartitionKey:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,252 @@
+package event_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/davidsbond/kollect/internal/event"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+func TestWriter_WriteCloudEvents(t *testing.T) {
+	t.Parallel()
+
+	payload := &resource.ResourceDeletedEvent{
+		Uid:       "test",
+		ClusterId: "test-cluster",
+	}
+
+	timestamp := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	evt := event.New(payload,
+		event.WithKey("test-cluster/test"),
+		event.WithAppliesAt(timestamp),
+		event.WithAttributes(map[string]string{
+			event.AttributeClusterID: "test-cluster",
+			event.AttributeKind:      "Deployment",
+			event.AttributeNamespace: "namespace",
+			event.AttributeName:      "example",
+		}),
+	)
+	evt.Timestamp = timestamp
+
+	tt := []struct {
+		Name     string
+		Encoding event.Encoding
+		Expected func(t *testing.T, msg *pubsub.Message)
+	}{
+		{
+			Name:     "It should write events in CloudEvents structured mode",
+			Encoding: event.EncodingCloudEventsStructured,
+			Expected: func(t *testing.T, msg *pubsub.Message) {
+				assert.EqualValues(t, "application/cloudevents+json", msg.Metadata["content-type"])
+
+				var ce map[string]interface{}
+				require.NoError(t, json.Unmarshal(msg.Body, &ce))
+				assert.EqualValues(t, "1.0", ce["specversion"])
+				assert.EqualValues(t, evt.ID, ce["id"])
+				assert.EqualValues(t, "test-cluster", ce["source"])
+				assert.EqualValues(t, "io.kollect.resource.deleted.v1", ce["type"])
+				assert.EqualValues(t, "namespace/example", ce["subject"])
+				assert.EqualValues(t, "2022-01-01T00:00:00Z", ce["time"])
+				assert.EqualValues(t, "Deployment", ce["kind"])
+				assert.EqualValues(t, "application/json", ce["datacontenttype"])
+				assert.EqualValues(t, map[string]interface{}{"uid": "test", "clusterId": "test-cluster"}, ce["data"])
+			},
+		},
+		{
+			Name:     "It should write events in CloudEvents binary mode",
+			Encoding: event.EncodingCloudEventsBinary,
+			Expected: func(t *testing.T, msg *pubsub.Message) {
+				assert.EqualValues(t, "application/json", msg.Metadata["content-type"])
+				assert.EqualValues(t, "1.0", msg.Metadata["ce-specversion"])
+				assert.EqualValues(t, evt.ID, msg.Metadata["ce-id"])
+				assert.EqualValues(t, "test-cluster", msg.Metadata["ce-source"])
+				assert.EqualValues(t, "io.kollect.resource.deleted.v1", msg.Metadata["ce-type"])
+				assert.EqualValues(t, "namespace/example", msg.Metadata["ce-subject"])
+				assert.EqualValues(t, "2022-01-01T00:00:00Z", msg.Metadata["ce-time"])
+				assert.EqualValues(t, "Deployment", msg.Metadata["ce-kind"])
+				assert.JSONEq(t, `{"uid": "test", "clusterId": "test-cluster"}`, string(msg.Body))
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx := context.Background()
+			url := "mem://cloudevents-" + string(tc.Encoding)
+
+			writer, err := event.NewWriter(ctx, url, event.WithEncoding(tc.Encoding))
+			require.NoError(t, err)
+
+			subscription, err := pubsub.OpenSubscription(ctx, url)
+			require.NoError(t, err)
+
+			require.NoError(t, writer.Write(ctx, evt))
+
+			msg, err := subscription.Receive(ctx)
+			require.NoError(t, err)
+			msg.Ack()
+
+			tc.Expected(t, msg)
+			require.NoError(t, subscription.Shutdown(ctx))
+			require.NoError(t, writer.Close())
+		})
+	}
+}
+
+func TestWriter_WriteJSON(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	writer, err := event.NewWriter(ctx, "mem://json?encoding=json")
+	require.NoError(t, err)
+
+	subscription, err := pubsub.OpenSubscription(ctx, "mem://json")
+	require.NoError(t, err)
+
+	evt := event.New(&resource.ResourceDeletedEvent{Uid: "test", ClusterId: "test-cluster"})
+	require.NoError(t, writer.Write(ctx, evt))
+
+	msg, err := subscription.Receive(ctx)
+	require.NoError(t, err)
+	msg.Ack()
+
+	assert.EqualValues(t, "application/json", msg.Metadata["content-type"])
+
+	var envelope map[string]interface{}
+	require.NoError(t, json.Unmarshal(msg.Body, &envelope))
+	assert.EqualValues(t, evt.ID, envelope["id"])
+	assert.EqualValues(t, map[string]interface{}{
+		"@type":     "type.googleapis.com/kollect.resource.event.v1.ResourceDeletedEvent",
+		"uid":       "test",
+		"clusterId": "test-cluster",
+	}, envelope["payload"])
+
+	require.NoError(t, subscription.Shutdown(ctx))
+	require.NoError(t, writer.Close())
+}
+
+func TestReader_ReadEncodings(t *testing.T) {
+	t.Parallel()
+
+	payload := &resource.ResourceCreatedEvent{
+		Uid:       "test",
+		Resource:  []byte(`{"kind": "Deployment"}`),
+		ClusterId: "test-cluster",
+	}
+
+	tt := []struct {
+		Name       string
+		Encoding   event.Encoding
+		DataFormat event.DataFormat
+	}{
+		{Name: "It should read protobuf events", Encoding: event.EncodingProto},
+		{Name: "It should read JSON events", Encoding: event.EncodingJSON},
+		{Name: "It should read structured CloudEvents with JSON data", Encoding: event.EncodingCloudEventsStructured, DataFormat: event.DataFormatJSON},
+		{Name: "It should read structured CloudEvents with protobuf data", Encoding: event.EncodingCloudEventsStructured, DataFormat: event.DataFormatProto},
+		{Name: "It should read binary CloudEvents with JSON data", Encoding: event.EncodingCloudEventsBinary, DataFormat: event.DataFormatJSON},
+		{Name: "It should read binary CloudEvents with protobuf data", Encoding: event.EncodingCloudEventsBinary, DataFormat: event.DataFormatProto},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			url := "mem://encodings-" + string(tc.Encoding) + "-" + string(tc.DataFormat)
+			opts := []event.WriterOption{event.WithEncoding(tc.Encoding)}
+			if tc.DataFormat != "" {
+				opts = append(opts, event.WithDataFormat(tc.DataFormat))
+			}
+
+			writer, err := event.NewWriter(ctx, url, opts...)
+			require.NoError(t, err)
+
+			reader, err := event.NewReader(ctx, url)
+			require.NoError(t, err)
+
+			expected := event.New(payload, event.WithAttributes(map[string]string{
+				event.AttributeClusterID: "test-cluster",
+				event.AttributeKind:      "Deployment",
+			}))
+			require.NoError(t, writer.Write(ctx, expected))
+
+			err = reader.Read(ctx, func(ctx context.Context, actual event.Event) error {
+				cancel()
+
+				assert.EqualValues(t, expected.ID, actual.ID)
+				assert.True(t, expected.Timestamp.Equal(actual.Timestamp))
+				assert.True(t, expected.AppliesAt.Equal(actual.AppliesAt))
+				assert.EqualValues(t, expected.Attributes, actual.Attributes)
+				assert.True(t, proto.Equal(expected.Payload, actual.Payload))
+				return nil
+			})
+
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+			require.NoError(t, writer.Close())
+		})
+	}
+}
+
+func TestReader_ReadCloudEventsBinaryPrefixes(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name   string
+		Prefix string
+	}{
+		{Name: "It should read binary CloudEvents using the HTTP binding", Prefix: "ce-"},
+		{Name: "It should read binary CloudEvents using the Kafka binding", Prefix: "ce_"},
+		{Name: "It should read binary CloudEvents using the AMQP binding", Prefix: "cloudEvents:"},
+	}
+
+	for i, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			url := fmt.Sprintf("mem://cloudevents-prefix-%d", i)
+			topic, err := pubsub.OpenTopic(ctx, url)
+			require.NoError(t, err)
+
+			reader, err := event.NewReader(ctx, url)
+			require.NoError(t, err)
+
+			require.NoError(t, topic.Send(ctx, &pubsub.Message{
+				Body: []byte(`{"uid": "test", "clusterId": "test-cluster"}`),
+				Metadata: map[string]string{
+					"content-type":            "application/json",
+					tc.Prefix + "specversion": "1.0",
+					tc.Prefix + "id":          "test-id",
+					tc.Prefix + "source":      "test-cluster",
+					tc.Prefix + "type":        "io.kollect.resource.deleted.v1",
+					tc.Prefix + "time":        "2022-01-01T00:00:00Z",
+					tc.Prefix + "kind":        "Deployment",
+				},
+			}))
+
+			err = reader.Read(ctx, func(ctx context.Context, actual event.Event) error {
+				cancel()
+
+				assert.EqualValues(t, "test-id", actual.ID)
+				assert.EqualValues(t, map[string]string{"kind": "Deployment"}, actual.Attributes)
+				assert.True(t, proto.Equal(&resource.ResourceDeletedEvent{Uid: "test", ClusterId: "test-cluster"}, actual.Payload))
+				return nil
+			})
+
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+			require.NoError(t, topic.Shutdown(context.Background()))
+		})
+	}
+}
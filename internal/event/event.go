@@ -7,11 +7,14 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/davidsbond/kollect/proto/kollect/event/v1"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
 
 	// Gocloud driver for GCP PubSub.
 	_ "gocloud.dev/pubsub/gcppubsub"
@@ -27,6 +30,17 @@ import (
 	_ "gocloud.dev/pubsub/rabbitpubsub"
 	// Gocloud driver for AWS SNS/SQS.
 	_ "gocloud.dev/pubsub/awssnssqs"
+
+	// Gocloud driver for AWS S3.
+	_ "gocloud.dev/blob/s3blob"
+	// Gocloud driver for GCP Cloud Storage.
+	_ "gocloud.dev/blob/gcsblob"
+	// Gocloud driver for Azure Blob Storage.
+	_ "gocloud.dev/blob/azureblob"
+	// Gocloud driver for the local filesystem.
+	_ "gocloud.dev/blob/fileblob"
+	// Gocloud driver for in-memory blob storage.
+	_ "gocloud.dev/blob/memblob"
 )
 
 type (
@@ -37,6 +51,10 @@ type (
 		Timestamp time.Time
 		AppliesAt time.Time
 		Payload   proto.Message
+
+		// Attributes contains additional metadata describing the subject of the event. See the Attribute constants
+		// for well-known keys.
+		Attributes map[string]string
 	}
 
 	// The Handler type is a function that processes an inbound event.
@@ -46,6 +64,30 @@ type (
 	Option func(e *Event)
 )
 
+// Well-known keys for Event.Attributes that describe the cluster resource an event relates to.
+const (
+	AttributeClusterID = "cluster"
+	AttributeGroup     = "group"
+	AttributeVersion   = "version"
+	AttributeKind      = "kind"
+	AttributeNamespace = "namespace"
+	AttributeName      = "name"
+	AttributeLabels    = "labels"
+)
+
+// Values returned by Event.Type for events describing changes to cluster resources.
+const (
+	TypeResourceCreated = "created"
+	TypeResourceUpdated = "updated"
+	TypeResourceDeleted = "deleted"
+)
+
+var eventTypes = map[protoreflect.FullName]string{
+	(&resource.ResourceCreatedEvent{}).ProtoReflect().Descriptor().FullName(): TypeResourceCreated,
+	(&resource.ResourceUpdatedEvent{}).ProtoReflect().Descriptor().FullName(): TypeResourceUpdated,
+	(&resource.ResourceDeletedEvent{}).ProtoReflect().Descriptor().FullName(): TypeResourceDeleted,
+}
+
 // New returns a new Event instance that contains the provided payload. A unique identifier
 // is generated and timestamps are set to now.
 func New(payload proto.Message, opts ...Option) Event {
@@ -63,42 +105,113 @@ func New(payload proto.Message, opts ...Option) Event {
 	return e
 }
 
+// typeName returns the fully qualified name of the event's payload, or "unknown" for events without one, such as
+// those given for messages that could not be decoded.
 func (e Event) typeName() string {
+	if e.Payload == nil {
+		return "unknown"
+	}
+
 	return string(e.Payload.ProtoReflect().Descriptor().FullName())
 }
 
-func (e Event) marshal() ([]byte, error) {
+// Type returns a short name describing the type of the event, one of the Type constants. For events whose payload
+// does not describe a change to a cluster resource, the fully qualified name of the payload is returned, or
+// "unknown" if there is no payload.
+func (e Event) Type() string {
+	if e.Payload == nil {
+		return e.typeName()
+	}
+
+	if typ, ok := eventTypes[e.Payload.ProtoReflect().Descriptor().FullName()]; ok {
+		return typ
+	}
+
+	return e.typeName()
+}
+
+// orderingKey returns the key used to determine the order events must be handled in. Event buses that do not support
+// message keys will not populate Event.Key, in which case events describing the same resource share a key.
+func (e Event) orderingKey() string {
+	if e.Key != "" {
+		return e.Key
+	}
+
+	type resourceEvent interface {
+		GetClusterId() string
+		GetUid() string
+	}
+
+	if payload, ok := e.Payload.(resourceEvent); ok {
+		return payload.GetClusterId() + "/" + payload.GetUid()
+	}
+
+	return e.ID
+}
+
+func (e Event) envelope() (*event.Envelope, error) {
 	any, err := anypb.New(e.Payload)
 	if err != nil {
 		return nil, err
 	}
 
-	envelope := &event.Envelope{
-		Id:        e.ID,
-		Timestamp: timestamppb.New(e.Timestamp),
-		AppliesAt: timestamppb.New(e.AppliesAt),
-		Payload:   any,
+	return &event.Envelope{
+		Id:         e.ID,
+		Timestamp:  timestamppb.New(e.Timestamp),
+		AppliesAt:  timestamppb.New(e.AppliesAt),
+		Payload:    any,
+		Attributes: e.Attributes,
+	}, nil
+}
+
+func (e Event) marshal() ([]byte, error) {
+	envelope, err := e.envelope()
+	if err != nil {
+		return nil, err
 	}
 
 	return proto.Marshal(envelope)
 }
 
+func (e Event) marshalJSON() ([]byte, error) {
+	envelope, err := e.envelope()
+	if err != nil {
+		return nil, err
+	}
+
+	return protojson.Marshal(envelope)
+}
+
 func unmarshal(b []byte) (Event, error) {
 	var env event.Envelope
 	if err := proto.Unmarshal(b, &env); err != nil {
 		return Event{}, err
 	}
 
+	return fromEnvelope(&env)
+}
+
+func unmarshalJSON(b []byte) (Event, error) {
+	var env event.Envelope
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(b, &env); err != nil {
+		return Event{}, err
+	}
+
+	return fromEnvelope(&env)
+}
+
+func fromEnvelope(env *event.Envelope) (Event, error) {
 	payload, err := env.Payload.UnmarshalNew()
 	if err != nil {
 		return Event{}, err
 	}
 
 	return Event{
-		ID:        env.GetId(),
-		Timestamp: env.GetTimestamp().AsTime(),
-		AppliesAt: env.GetAppliesAt().AsTime(),
-		Payload:   payload,
+		ID:         env.GetId(),
+		Timestamp:  env.GetTimestamp().AsTime(),
+		AppliesAt:  env.GetAppliesAt().AsTime(),
+		Payload:    payload,
+		Attributes: env.GetAttributes(),
 	}, nil
 }
 
@@ -109,6 +222,13 @@ func WithAppliesAt(appliesAt time.Time) Option {
 	}
 }
 
+// WithAttributes returns an Option that can be provided to New to set the Event.Attributes field.
+func WithAttributes(attributes map[string]string) Option {
+	return func(e *Event) {
+		e.Attributes = attributes
+	}
+}
+
 // WithKey returns an Option that can be provided to New to set the Event.Key field.
 func WithKey(key string) Option {
 	return func(e *Event) {
@@ -0,0 +1,16 @@
+package event
+
+import (
+	"context"
+
+	"k8s.io/klog/v2"
+)
+
+// The name of the logger used by this package.
+const loggerName = "event"
+
+// logger returns the logger from the context, named after this package. If the context has no logger, the klog
+// logger is used.
+func logger(ctx context.Context) klog.Logger {
+	return klog.LoggerWithName(klog.FromContext(ctx), loggerName)
+}
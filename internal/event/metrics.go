@@ -2,40 +2,239 @@ package event
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
-)
 
-const (
-	namespace = "kollect"
-	subsystem = "events"
+	"github.com/davidsbond/kollect/internal/metrics"
 )
 
-func init() {
-	prometheus.MustRegister(
-		eventsWritten,
-		eventsRead,
-		eventsIgnored,
-	)
-}
-
-var (
-	eventsWritten = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: namespace,
-		Subsystem: subsystem,
-		Name:      "written_total",
-		Help:      "Total number of events written to the stream",
-	}, []string{"key", "type"})
-
-	eventsRead = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: namespace,
-		Subsystem: subsystem,
-		Name:      "read_total",
-		Help:      "Total number of events read from the stream",
-	}, []string{"key", "type"})
-
-	eventsIgnored = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: namespace,
-		Subsystem: subsystem,
-		Name:      "ignored_total",
-		Help:      "Total number of events ignored from the stream",
-	}, []string{"key", "type"})
+const subsystem = "events"
+
+type (
+	// The writerMetrics type contains the prometheus metrics recorded by a Writer, including those recorded for it
+	// when used as a sink of a MultiWriter.
+	writerMetrics struct {
+		labels eventLabels
+
+		eventsPublished    *prometheus.CounterVec
+		publishDuration    *prometheus.HistogramVec
+		messageSize        *prometheus.HistogramVec
+		eventsClaimChecked *prometheus.CounterVec
+		sinkWritten        *prometheus.CounterVec
+		sinkFailed         *prometheus.CounterVec
+		sinkHealthy        *prometheus.GaugeVec
+
+		// Deprecated metrics labelled by event key, only set when legacy metrics are enabled.
+		eventsWritten *prometheus.CounterVec
+	}
+
+	// The readerMetrics type contains the prometheus metrics recorded by a Reader.
+	readerMetrics struct {
+		labels eventLabels
+
+		eventsConsumed     *prometheus.CounterVec
+		eventsSkipped      *prometheus.CounterVec
+		eventsRetried      *prometheus.CounterVec
+		eventsFailed       prometheus.Counter
+		eventsDeadLettered prometheus.Counter
+
+		// Deprecated metrics labelled by event key, only set when legacy metrics are enabled.
+		eventsRead    *prometheus.CounterVec
+		eventsIgnored *prometheus.CounterVec
+	}
+
+	// The eventLabels type determines the labels used for metrics describing individual events. Labels are limited
+	// to those with a bounded number of values, so that the number of series does not grow with the number of
+	// resources.
+	eventLabels struct {
+		namespace bool
+	}
 )
+
+// Buckets used for the size, in bytes, of messages written to the stream. These range from 256 bytes to 4 megabytes.
+var messageSizeBuckets = prometheus.ExponentialBuckets(256, 4, 8)
+
+// WithWriterMetrics returns a WriterOption that sets how the Writer's metrics are named and where they are
+// registered. By default, metrics are not registered.
+func WithWriterMetrics(config metrics.Config) WriterOption {
+	return func(w *Writer) {
+		w.metricsConfig = config
+	}
+}
+
+// WithReaderMetrics returns a ReaderOption that sets how the Reader's metrics are named and where they are
+// registered. By default, metrics are not registered.
+func WithReaderMetrics(config metrics.Config) ReaderOption {
+	return func(r *Reader) {
+		r.metricsConfig = config
+	}
+}
+
+// names returns the label names for metrics describing individual events, followed by any extra names.
+func (l eventLabels) names(extra ...string) []string {
+	names := []string{"type", "group", "version", "kind"}
+	if l.namespace {
+		names = append(names, "namespace")
+	}
+
+	return append(names, extra...)
+}
+
+// values returns the label values describing the event, in the same order as names, followed by any extra values.
+func (l eventLabels) values(evt Event, extra ...string) []string {
+	values := []string{
+		evt.Type(),
+		evt.Attributes[AttributeGroup],
+		evt.Attributes[AttributeVersion],
+		evt.Attributes[AttributeKind],
+	}
+
+	if l.namespace {
+		values = append(values, evt.Attributes[AttributeNamespace])
+	}
+
+	return append(values, extra...)
+}
+
+func newWriterMetrics(config metrics.Config) (*writerMetrics, error) {
+	var err error
+	m := writerMetrics{
+		labels: eventLabels{namespace: config.NamespaceLabel},
+	}
+
+	m.eventsPublished, err = config.NewCounterVec(subsystem, "published_total",
+		"Total number of events written to the stream", m.labels.names("sink"))
+	if err != nil {
+		return nil, err
+	}
+
+	m.publishDuration, err = config.NewHistogramVec(subsystem, "publish_duration_seconds",
+		"Time taken to write an event to the stream", prometheus.DefBuckets, []string{"type", "sink"})
+	if err != nil {
+		return nil, err
+	}
+
+	m.messageSize, err = config.NewHistogramVec(subsystem, "message_size_bytes",
+		"Size of the messages written to the stream", messageSizeBuckets, []string{"type", "sink"})
+	if err != nil {
+		return nil, err
+	}
+
+	m.eventsClaimChecked, err = config.NewCounterVec(subsystem, "claim_checked_total",
+		"Total number of events written to blob storage due to their size", []string{"type"})
+	if err != nil {
+		return nil, err
+	}
+
+	m.sinkWritten, err = config.NewCounterVec(subsystem, "sink_written_total",
+		"Total number of events written to an individual sink", []string{"sink"})
+	if err != nil {
+		return nil, err
+	}
+
+	m.sinkFailed, err = config.NewCounterVec(subsystem, "sink_failed_total",
+		"Total number of events that failed to be written to an individual sink", []string{"sink"})
+	if err != nil {
+		return nil, err
+	}
+
+	m.sinkHealthy, err = config.NewGaugeVec(subsystem, "sink_healthy",
+		"Whether the last event written to an individual sink was successful", []string{"sink"})
+	if err != nil {
+		return nil, err
+	}
+
+	if !config.Legacy {
+		return &m, nil
+	}
+
+	m.eventsWritten, err = config.NewCounterVec(subsystem, "written_total",
+		"Deprecated: use published_total. Total number of events written to the stream", []string{"key", "type"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+func newReaderMetrics(config metrics.Config) (*readerMetrics, error) {
+	var err error
+	m := readerMetrics{
+		labels: eventLabels{namespace: config.NamespaceLabel},
+	}
+
+	m.eventsConsumed, err = config.NewCounterVec(subsystem, "consumed_total",
+		"Total number of events read from the stream and handled successfully", m.labels.names())
+	if err != nil {
+		return nil, err
+	}
+
+	m.eventsSkipped, err = config.NewCounterVec(subsystem, "skipped_total",
+		"Total number of messages read from the stream that were acknowledged without being handled", []string{"reason"})
+	if err != nil {
+		return nil, err
+	}
+
+	m.eventsRetried, err = config.NewCounterVec(subsystem, "retried_total",
+		"Total number of times handling an event read from the stream was retried", []string{"type"})
+	if err != nil {
+		return nil, err
+	}
+
+	m.eventsFailed, err = config.NewCounter(subsystem, "failed_total",
+		"Total number of messages read from the stream that could not be decoded or handled")
+	if err != nil {
+		return nil, err
+	}
+
+	m.eventsDeadLettered, err = config.NewCounter(subsystem, "dead_lettered_total",
+		"Total number of messages read from the stream that were dead lettered")
+	if err != nil {
+		return nil, err
+	}
+
+	if !config.Legacy {
+		return &m, nil
+	}
+
+	m.eventsRead, err = config.NewCounterVec(subsystem, "read_total",
+		"Deprecated: use consumed_total. Total number of events read from the stream", []string{"key", "type"})
+	if err != nil {
+		return nil, err
+	}
+
+	m.eventsIgnored, err = config.NewCounterVec(subsystem, "ignored_total",
+		"Deprecated: use skipped_total. Total number of events ignored from the stream", []string{"key", "type"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// published records an event successfully written to the given sink.
+func (m *writerMetrics) published(evt Event, sink string, size int, seconds float64) {
+	m.eventsPublished.WithLabelValues(m.labels.values(evt, sink)...).Inc()
+	m.publishDuration.WithLabelValues(evt.Type(), sink).Observe(seconds)
+	m.messageSize.WithLabelValues(evt.Type(), sink).Observe(float64(size))
+
+	if m.eventsWritten != nil {
+		m.eventsWritten.WithLabelValues(evt.Key, evt.typeName()).Inc()
+	}
+}
+
+// consumed records an event that was read from the stream and handled successfully.
+func (m *readerMetrics) consumed(evt Event) {
+	m.eventsConsumed.WithLabelValues(m.labels.values(evt)...).Inc()
+
+	if m.eventsRead != nil {
+		m.eventsRead.WithLabelValues(evt.Key, evt.typeName()).Inc()
+	}
+}
+
+// skipped records a message that was acknowledged without being handled for the given reason.
+func (m *readerMetrics) skipped(key, reason string) {
+	m.eventsSkipped.WithLabelValues(reason).Inc()
+
+	if m.eventsIgnored != nil {
+		m.eventsIgnored.WithLabelValues(key, "unknown").Inc()
+	}
+}
@@ -0,0 +1,114 @@
+package event_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/kollect/internal/event"
+	"github.com/davidsbond/kollect/internal/metrics"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+func TestWriter_WriteMetrics(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name           string
+		Config         metrics.Config
+		ExpectedLabels map[string]string
+		ExpectsLegacy  bool
+	}{
+		{
+			Name: "It should label events by type, group, version, kind and sink",
+			ExpectedLabels: map[string]string{
+				"type":    event.TypeResourceCreated,
+				"group":   "apps",
+				"version": "v1",
+				"kind":    "Deployment",
+				"sink":    "mem://metrics-0",
+			},
+		},
+		{
+			Name:   "It should label events by namespace when enabled",
+			Config: metrics.Config{NamespaceLabel: true},
+			ExpectedLabels: map[string]string{
+				"type":      event.TypeResourceCreated,
+				"group":     "apps",
+				"version":   "v1",
+				"kind":      "Deployment",
+				"namespace": "default",
+				"sink":      "mem://metrics-1",
+			},
+		},
+		{
+			Name:   "It should record legacy metrics when enabled",
+			Config: metrics.Config{Legacy: true},
+			ExpectedLabels: map[string]string{
+				"type":    event.TypeResourceCreated,
+				"group":   "apps",
+				"version": "v1",
+				"kind":    "Deployment",
+				"sink":    "mem://metrics-2",
+			},
+			ExpectsLegacy: true,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx := context.Background()
+			registry := prometheus.NewRegistry()
+			tc.Config.Registerer = registry
+
+			url := fmt.Sprintf("mem://metrics-%d", i)
+			writer, err := event.NewWriter(ctx, url, event.WithWriterMetrics(tc.Config))
+			require.NoError(t, err)
+			defer writer.Close()
+
+			require.NoError(t, writer.Write(ctx, event.New(&resource.ResourceCreatedEvent{
+				Uid:       "test",
+				Resource:  []byte(`{"kind": "Deployment"}`),
+				ClusterId: "test",
+			}, event.WithKey("test/test"), event.WithAttributes(map[string]string{
+				event.AttributeGroup:     "apps",
+				event.AttributeVersion:   "v1",
+				event.AttributeKind:      "Deployment",
+				event.AttributeNamespace: "default",
+			}))))
+
+			families, err := registry.Gather()
+			require.NoError(t, err)
+
+			series := make(map[string][]map[string]string)
+			for _, family := range families {
+				for _, metric := range family.GetMetric() {
+					labels := make(map[string]string)
+					for _, label := range metric.GetLabel() {
+						labels[label.GetName()] = label.GetValue()
+					}
+
+					series[family.GetName()] = append(series[family.GetName()], labels)
+				}
+			}
+
+			assert.Equal(t, []map[string]string{tc.ExpectedLabels}, series["kollect_events_published_total"])
+			assert.Len(t, series["kollect_events_publish_duration_seconds"], 1)
+			assert.Len(t, series["kollect_events_message_size_bytes"], 1)
+
+			if !tc.ExpectsLegacy {
+				assert.NotContains(t, series, "kollect_events_written_total")
+				return
+			}
+
+			assert.Equal(t, []map[string]string{{
+				"key":  "test/test",
+				"type": "kollect.resource.event.v1.ResourceCreatedEvent",
+			}}, series["kollect_events_written_total"])
+		})
+	}
+}
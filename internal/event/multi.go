@@ -0,0 +1,191 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// The MultiWriter type is used to write the same events to multiple event streams, referred to as sinks. The
+	// Delivery determines whether writing an event fails when writing to an individual sink fails.
+	MultiWriter struct {
+		sinks    []*sink
+		delivery Delivery
+	}
+
+	// The Delivery type describes the delivery semantics of a MultiWriter.
+	Delivery string
+
+	// The SinkStatus type describes the health of an individual sink of a MultiWriter.
+	SinkStatus struct {
+		// The name of the sink, this is its URL without any query parameters or user information.
+		Name string `json:"name"`
+		// Whether the last event written to the sink was successful.
+		Healthy bool `json:"healthy"`
+		// The time the last event was successfully written to the sink.
+		LastWrite time.Time `json:"lastWrite"`
+		// The last error returned when writing to the sink.
+		LastError string `json:"lastError,omitempty"`
+		// The time the last error was returned when writing to the sink.
+		LastErrorTime time.Time `json:"lastErrorTime"`
+		// The time events started to continuously fail to be written to the sink. Zero once an event is written
+		// successfully.
+		FailingSince time.Time `json:"failingSince"`
+	}
+
+	sink struct {
+		name   string
+		writer *Writer
+
+		mux    *sync.RWMutex
+		status SinkStatus
+	}
+)
+
+// Supported values for the Delivery type.
+const (
+	// DeliveryAll requires that events are successfully written to all sinks.
+	DeliveryAll Delivery = "all"
+	// DeliveryBestEffort requires that events are successfully written to at least one sink. Failures for individual
+	// sinks are logged and recorded in metrics.
+	DeliveryBestEffort Delivery = "best-effort"
+)
+
+// NewMultiWriter returns a new instance of the MultiWriter type that writes events to each of the event streams
+// identified by the given URLs. The provided options are used when opening the topic for each URL.
+func NewMultiWriter(ctx context.Context, urls []string, delivery Delivery, opts ...WriterOption) (*MultiWriter, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("at least one url is required")
+	}
+
+	if delivery != DeliveryAll && delivery != DeliveryBestEffort {
+		return nil, fmt.Errorf("unsupported delivery %q", delivery)
+	}
+
+	m := &MultiWriter{delivery: delivery}
+	for _, urlStr := range urls {
+		writer, err := NewWriter(ctx, urlStr, opts...)
+		if err != nil {
+			// Errors closing the sinks already opened are ignored in favour of the error that caused the failure.
+			_ = m.Close()
+			return nil, fmt.Errorf("failed to open sink %s: %w", sinkName(urlStr), err)
+		}
+
+		name := sinkName(urlStr)
+		m.sinks = append(m.sinks, &sink{
+			name:   name,
+			writer: writer,
+			mux:    &sync.RWMutex{},
+			status: SinkStatus{Name: name, Healthy: true},
+		})
+
+		writer.metrics.sinkHealthy.WithLabelValues(name).Set(1)
+	}
+
+	return m, nil
+}
+
+// Write an event to all sinks concurrently. When using DeliveryAll, an error is returned if writing to any sink
+// fails. When using DeliveryBestEffort, an error is only returned if writing to all sinks fails.
+func (m *MultiWriter) Write(ctx context.Context, evt Event) error {
+	errs := make([]error, len(m.sinks))
+
+	wg := &sync.WaitGroup{}
+	for i, s := range m.sinks {
+		wg.Add(1)
+		go func(i int, s *sink) {
+			defer wg.Done()
+			errs[i] = s.write(ctx, evt)
+		}(i, s)
+	}
+	wg.Wait()
+
+	failed := make([]string, 0)
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		failed = append(failed, fmt.Sprintf("%s: %v", m.sinks[i].name, err))
+		if m.delivery == DeliveryBestEffort {
+			logger(ctx).Error(err, "Failed to write event to sink", "event", evt.ID, "type", evt.typeName(), "sink", m.sinks[i].name)
+		}
+	}
+
+	switch {
+	case len(failed) == 0:
+		return nil
+	case m.delivery == DeliveryBestEffort && len(failed) < len(m.sinks):
+		return nil
+	default:
+		return fmt.Errorf("failed to write event %s to %d of %d sinks: %s", evt.ID, len(failed), len(m.sinks), strings.Join(failed, ", "))
+	}
+}
+
+// Status returns the health of each sink.
+func (m *MultiWriter) Status() []SinkStatus {
+	statuses := make([]SinkStatus, len(m.sinks))
+	for i, s := range m.sinks {
+		s.mux.RLock()
+		statuses[i] = s.status
+		s.mux.RUnlock()
+	}
+
+	return statuses
+}
+
+// Close the connection to all sinks. All sinks are closed regardless of errors, the first error encountered is
+// returned.
+func (m *MultiWriter) Close() error {
+	var err error
+	for _, s := range m.sinks {
+		if closeErr := s.writer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+func (s *sink) write(ctx context.Context, evt Event) error {
+	err := s.writer.Write(ctx, evt)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.status.Healthy = err == nil
+	if err != nil {
+		s.status.LastError = err.Error()
+		s.status.LastErrorTime = time.Now()
+		if s.status.FailingSince.IsZero() {
+			s.status.FailingSince = s.status.LastErrorTime
+		}
+		s.writer.metrics.sinkFailed.WithLabelValues(s.name).Inc()
+		s.writer.metrics.sinkHealthy.WithLabelValues(s.name).Set(0)
+		return err
+	}
+
+	s.status.LastWrite = time.Now()
+	s.status.FailingSince = time.Time{}
+	s.writer.metrics.sinkWritten.WithLabelValues(s.name).Inc()
+	s.writer.metrics.sinkHealthy.WithLabelValues(s.name).Set(1)
+	return nil
+}
+
+// sinkName returns a name for the sink identified using the given URL that is safe to expose in logs and metrics.
+func sinkName(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "unknown"
+	}
+
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
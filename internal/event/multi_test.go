@@ -0,0 +1,95 @@
+package event_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
+
+	"github.com/davidsbond/kollect/internal/event"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+func TestMultiWriter_Write(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name          string
+		Delivery      event.Delivery
+		BreakSink     bool
+		ExpectsError  bool
+		ExpectHealthy []bool
+	}{
+		{
+			Name:          "It should write events to all sinks",
+			Delivery:      event.DeliveryAll,
+			ExpectHealthy: []bool{true, true},
+		},
+		{
+			Name:          "It should return an error if any sink fails using all delivery",
+			Delivery:      event.DeliveryAll,
+			BreakSink:     true,
+			ExpectsError:  true,
+			ExpectHealthy: []bool{true, false},
+		},
+		{
+			Name:          "It should not return an error if any sink succeeds using best-effort delivery",
+			Delivery:      event.DeliveryBestEffort,
+			BreakSink:     true,
+			ExpectHealthy: []bool{true, false},
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx := context.Background()
+			urls := []string{
+				fmt.Sprintf("mem://multi-%d-first", i),
+				fmt.Sprintf("mem://multi-%d-second", i),
+			}
+
+			// In-memory topics are shared by name, so opening them here allows the test to subscribe to them and
+			// shut them down to simulate a broken sink.
+			topics := make([]*pubsub.Topic, len(urls))
+			for j, u := range urls {
+				var err error
+				topics[j], err = pubsub.OpenTopic(ctx, u)
+				require.NoError(t, err)
+			}
+
+			subscription, err := pubsub.OpenSubscription(ctx, urls[0])
+			require.NoError(t, err)
+			defer subscription.Shutdown(ctx)
+
+			writer, err := event.NewMultiWriter(ctx, urls, tc.Delivery)
+			require.NoError(t, err)
+			defer writer.Close()
+
+			if tc.BreakSink {
+				require.NoError(t, topics[1].Shutdown(ctx))
+			}
+
+			err = writer.Write(ctx, event.New(&resource.ResourceCreatedEvent{Uid: "test"}))
+			if tc.ExpectsError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			msg, err := subscription.Receive(ctx)
+			require.NoError(t, err)
+			msg.Ack()
+
+			statuses := writer.Status()
+			require.Len(t, statuses, len(tc.ExpectHealthy))
+			for j, status := range statuses {
+				assert.Equal(t, urls[j], status.Name)
+				assert.Equal(t, tc.ExpectHealthy[j], status.Healthy)
+				assert.Equal(t, tc.ExpectHealthy[j], status.FailingSince.IsZero())
+			}
+		})
+	}
+}
@@ -4,83 +4,549 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"sync"
 	"time"
 
 	servicebus "github.com/Azure/azure-service-bus-go"
 	"github.com/Shopify/sarama"
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/trace"
+	"gocloud.dev/blob"
 	"gocloud.dev/pubsub"
+	"golang.org/x/sync/errgroup"
 	gcppubsub "google.golang.org/genproto/googleapis/pubsub/v1"
 	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/davidsbond/kollect/internal/metrics"
+	"github.com/davidsbond/kollect/internal/tracing"
+	"github.com/davidsbond/kollect/proto/kollect/event/v1"
 )
 
 type (
 	// The Reader type is used to handle inbound events from a single topic.
 	Reader struct {
+		name         string
 		subscription *pubsub.Subscription
+		workers      int
+
+		// Determines how many times, and how often, handling an event is attempted before it is considered failed.
+		maxAttempts int
+		backoff     time.Duration
+
+		// How long events that are being handled when reading stops are given to finish.
+		drainTimeout time.Duration
+
+		// Determines what happens to messages that cannot be decoded or handled. When a dead letter handler is
+		// set, failed messages are passed to it and acknowledged. Otherwise, failed messages are nacked and Read
+		// returns an error, unless continueOnError is set.
+		deadLetter      DeadLetterHandler
+		deadLetterURL   string
+		deadLetterTopic *pubsub.Topic
+		continueOnError bool
+
+		// Invoked whenever a message is nacked.
+		onNack func(evt Event)
+
+		// Determines whether an event is handled, evaluated before the event referenced by a claim check is fetched.
+		filter func(evt Event) bool
+
+		metricsConfig metrics.Config
+		metrics       *readerMetrics
+		tracer        trace.Tracer
+
+		// Blob storage buckets used to fetch events referenced by claim checks, keyed by their URL. Buckets are
+		// opened as claim checks are read, only claim checks referencing an allowed URL are fetched.
+		buckets        map[string]*blob.Bucket
+		bucketMux      *sync.Mutex
+		claimCheckURLs []string
+	}
+
+	// The ReaderOption type is a function that can modify the behaviour of a Reader.
+	ReaderOption func(r *Reader)
+
+	// The delivery type pairs a message received from the stream with the event decoded from it.
+	delivery struct {
+		msg *pubsub.Message
+		evt Event
 	}
 )
 
+// The default time events being handled when the Reader stops are given to finish.
+const defaultDrainTimeout = time.Second * 30
+
 // NewReader creates a new instance of the Reader type that will read events from the configured
 // event stream provider identified using the given URL.
-func NewReader(ctx context.Context, urlStr string) (*Reader, error) {
+func NewReader(ctx context.Context, urlStr string, opts ...ReaderOption) (*Reader, error) {
+	r := &Reader{
+		name:         sinkName(urlStr),
+		tracer:       tracing.Tracer(nil),
+		workers:      1,
+		maxAttempts:  1,
+		drainTimeout: defaultDrainTimeout,
+		buckets:      make(map[string]*blob.Bucket),
+		bucketMux:    &sync.Mutex{},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	switch {
+	case r.workers < 1:
+		return nil, fmt.Errorf("invalid number of workers %d, at least one is required", r.workers)
+	case r.maxAttempts < 1:
+		return nil, fmt.Errorf("invalid number of attempts %d, at least one is required", r.maxAttempts)
+	case r.deadLetter != nil && r.deadLetterURL != "":
+		return nil, errors.New("a dead letter handler and dead letter topic cannot be used together")
+	}
+
+	m, err := newReaderMetrics(r.metricsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	r.metrics = m
+	if r.deadLetterURL != "" {
+		topic, err := pubsub.OpenTopic(ctx, r.deadLetterURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open dead letter topic: %w", err)
+		}
+
+		r.deadLetterTopic = topic
+		r.deadLetter = r.forward
+	}
+
 	subscription, err := pubsub.OpenSubscription(ctx, urlStr)
 	if err != nil {
+		if r.deadLetterTopic != nil {
+			// The error opening the subscription takes precedence over any error shutting down the topic.
+			_ = r.deadLetterTopic.Shutdown(ctx)
+		}
+
 		return nil, err
 	}
 
-	return &Reader{subscription: subscription}, nil
+	r.subscription = subscription
+	return r, nil
+}
+
+// WithWorkers returns a ReaderOption that sets the number of events the Reader will handle concurrently. Events with
+// the same key are always handled by the same worker, so are handled in the order they are received. Defaults to 1.
+func WithWorkers(n int) ReaderOption {
+	return func(r *Reader) {
+		r.workers = n
+	}
+}
+
+// WithRetry returns a ReaderOption that sets the maximum number of times handling an event is attempted before it
+// is considered failed. The Reader waits for the backoff duration between the first and second attempts, doubling
+// it for each attempt after that. Defaults to a single attempt.
+func WithRetry(maxAttempts int, backoff time.Duration) ReaderOption {
+	return func(r *Reader) {
+		r.maxAttempts = maxAttempts
+		r.backoff = backoff
+	}
+}
+
+// WithDrainTimeout returns a ReaderOption that sets how long events that are being handled when the Reader stops
+// are given to finish, after which the context given to their handler is cancelled. Defaults to 30 seconds.
+func WithDrainTimeout(timeout time.Duration) ReaderOption {
+	return func(r *Reader) {
+		r.drainTimeout = timeout
+	}
+}
+
+// WithContinueOnError returns a ReaderOption that causes the Reader to continue reading events when a message
+// cannot be decoded or handled, rather than returning an error. Failed messages are nacked, so may be redelivered
+// depending on the event bus.
+func WithContinueOnError() ReaderOption {
+	return func(r *Reader) {
+		r.continueOnError = true
+	}
+}
+
+// WithClaimCheckBucket returns a ReaderOption that allows the Reader to fetch events from the blob storage bucket
+// identified using the given URL, which must match the URL given to WithClaimCheck when writing events. Claim
+// checks referencing any other bucket fail to be decoded, so that publishers cannot cause the Reader to open
+// arbitrary buckets. Can be used multiple times to allow multiple buckets.
+func WithClaimCheckBucket(urlStr string) ReaderOption {
+	return func(r *Reader) {
+		r.claimCheckURLs = append(r.claimCheckURLs, urlStr)
+	}
+}
+
+// WithFilter returns a ReaderOption that sets a function used to determine whether an event is handled. It is
+// invoked once the message has been decoded and before the event referenced by a claim check is fetched, so that
+// events that are not handled do not need to be read from blob storage. For claim checked events, the payload is a
+// claim check but the remaining fields are those of the original event. Events for which fn returns false are
+// acknowledged without being handled.
+func WithFilter(fn func(evt Event) bool) ReaderOption {
+	return func(r *Reader) {
+		r.filter = fn
+	}
 }
 
-// Read events from the stream, invoking fn for each inbound event. This method will block until fn returns
-// an error when messages are not nackable or the provided context is cancelled.
+// WithNackHook returns a ReaderOption that invokes fn whenever a message is nacked. The event is blank for messages
+// that could not be decoded.
+func WithNackHook(fn func(evt Event)) ReaderOption {
+	return func(r *Reader) {
+		r.onNack = fn
+	}
+}
+
+// Read events from the stream, invoking fn for each inbound event. Events are handled concurrently by the number of
+// workers set using WithWorkers, events with the same key are handled sequentially. This method will block until an
+// event fails to be decoded or handled, receiving from the stream fails or the provided context is cancelled. See
+// WithRetry, WithDeadLetter and WithContinueOnError for changing how failed events are handled. When the context is
+// cancelled, events that are already being handled are given the timeout set using WithDrainTimeout to finish, those
+// that have not been handled are nacked and nil is returned.
 func (r *Reader) Read(ctx context.Context, fn Handler) error {
+	grp, grpCtx := errgroup.WithContext(ctx)
+
+	// Handlers are given a context that is not cancelled until the drain timeout has elapsed once reading stops, so
+	// that the events being handled can finish.
+	handlerCtx, cancel := drainContext(grpCtx, r.drainTimeout)
+	defer cancel()
+
+	queues := make([]chan delivery, r.workers)
+	for i := range queues {
+		queue := make(chan delivery)
+		queues[i] = queue
+
+		grp.Go(func() error {
+			return r.work(grpCtx, handlerCtx, queue, fn)
+		})
+	}
+
+	grp.Go(func() error {
+		defer func() {
+			for _, queue := range queues {
+				close(queue)
+			}
+		}()
+
+		return r.receive(grpCtx, queues)
+	})
+
+	err := grp.Wait()
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return nil
+	}
+
+	return err
+}
+
+// receive messages from the stream, decode them and dispatch them to a queue chosen using their ordering key, until
+// the context is cancelled or an error occurs.
+func (r *Reader) receive(ctx context.Context, queues []chan delivery) error {
 	for {
+		d, err := r.next(ctx, ctx)
+		if err != nil {
+			return err
+		}
+
+		queue := queues[shard(d.evt.orderingKey(), len(queues))]
 		select {
+		case queue <- d:
 		case <-ctx.Done():
+			r.nack(d.msg, d.evt)
 			return ctx.Err()
-		default:
-			msg, err := r.subscription.Receive(ctx)
-			if err != nil {
-				return err
-			}
+		}
+	}
+}
 
-			evt, err := unmarshal(msg.Body)
-			switch {
-			case errors.Is(err, protoregistry.NotFound):
-				continue
-			case err != nil:
-				nack(msg)
-				return err
-			}
+// next returns the next message from the stream that can be decoded. Messages are received using receiveCtx,
+// which allows the wait for a message to be bounded separately to ctx. Messages with unknown payloads are
+// acknowledged and skipped, as are those whose events do not match the filter set using WithFilter. Messages that
+// cannot be decoded are failed and skipped.
+func (r *Reader) next(ctx, receiveCtx context.Context) (delivery, error) {
+	for {
+		msg, err := r.subscription.Receive(receiveCtx)
+		switch {
+		case err != nil && receiveCtx.Err() != nil:
+			return delivery{}, receiveCtx.Err()
+		case err != nil:
+			return delivery{}, err
+		}
 
-			evt.Key = consumerKey(msg)
-
-			err = fn(ctx, evt)
-			switch {
-			case err != nil:
-				nack(msg)
-				return fmt.Errorf("failed to handle event %s: %w", evt.ID, err)
-			default:
-				msg.Ack()
-				eventsRead.WithLabelValues(evt.Key, evt.typeName()).Inc()
-				return nil
+		evt, err := r.decode(ctx, msg.Body, msg.Metadata)
+		switch {
+		case errors.Is(err, protoregistry.NotFound):
+			// Events with payloads we do not know about cannot be handled, so are acknowledged to prevent them
+			// from being redelivered.
+			msg.Ack()
+			r.metrics.skipped(consumerKey(msg), "unknown-payload")
+			logger(ctx).V(2).Info("Skipped message with unknown payload", "message", msg.LoggableID)
+			continue
+		case errors.Is(err, errFiltered):
+			msg.Ack()
+			r.metrics.skipped(consumerKey(msg), "filtered")
+			logger(ctx).V(4).Info("Skipped message that does not match the filter", "message", msg.LoggableID)
+			continue
+		case err != nil:
+			if err = r.fail(ctx, msg, Event{}, 1, fmt.Errorf("failed to decode message %s: %w", msg.LoggableID, err)); err != nil {
+				return delivery{}, err
 			}
+
+			continue
 		}
+
+		if key := consumerKey(msg); key != "" {
+			evt.Key = key
+		}
+
+		return delivery{msg: msg, evt: evt}, nil
 	}
 }
 
-func nack(msg *pubsub.Message) {
-	if msg.Nackable() {
-		msg.Nack()
+// work handles the deliveries sent to the queue until it is closed. Events are handled using handlerCtx, ctx
+// determines whether the Reader is stopping.
+func (r *Reader) work(ctx, handlerCtx context.Context, queue <-chan delivery, fn Handler) error {
+	for d := range queue {
+		if err := r.process(ctx, handlerCtx, d, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// process the delivery using fn within a span whose parent is the span that wrote the message. The message is
+// acknowledged if it is handled, otherwise it is nacked or failed.
+func (r *Reader) process(ctx, handlerCtx context.Context, d delivery, fn Handler) error {
+	handlerCtx, span := r.startSpan(handlerCtx, d)
+	defer span.End()
+
+	attempts, err := r.handle(ctx, handlerCtx, d.evt, fn)
+	switch {
+	case err == nil:
+		d.msg.Ack()
+		r.metrics.consumed(d.evt)
+		logger(handlerCtx).V(4).Info("Handled event", "event", d.evt.ID, "type", d.evt.typeName(), "key", d.evt.Key, "attempts", attempts)
+		return nil
+	case ctx.Err() != nil:
+		// The reader is stopping, so the event is nacked to be redelivered rather than treated as failed.
+		r.nack(d.msg, d.evt)
+		return ctx.Err()
+	default:
+		err = fmt.Errorf("failed to handle event %s: %w", d.evt.ID, err)
+		tracing.Fail(span, err)
+		return r.fail(handlerCtx, d.msg, d.evt, attempts, err)
 	}
 }
 
+// handle the event using fn, retrying with an exponential backoff until it succeeds, the maximum number of attempts
+// is reached or ctx is cancelled. Returns the number of attempts made and the error returned by the final attempt.
+func (r *Reader) handle(ctx, handlerCtx context.Context, evt Event, fn Handler) (int, error) {
+	backoff := r.backoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(handlerCtx, evt); err == nil || attempt >= r.maxAttempts || ctx.Err() != nil {
+			return attempt, err
+		}
+
+		r.metrics.eventsRetried.WithLabelValues(evt.typeName()).Inc()
+		logger(handlerCtx).V(2).Info("Retrying event", "event", evt.ID, "type", evt.typeName(), "attempt", attempt, "backoff", backoff, "err", err)
+
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+}
+
+// fail handles a message that could not be decoded or handled. If a dead letter handler is set, the message is
+// passed to it and acknowledged. Otherwise, the message is nacked and the error is returned unless the Reader is
+// configured to continue on error.
+func (r *Reader) fail(ctx context.Context, msg *pubsub.Message, evt Event, attempts int, err error) error {
+	r.metrics.eventsFailed.Inc()
+
+	if r.deadLetter != nil {
+		dlErr := r.deadLetter(ctx, DeadLetter{
+			Body:     msg.Body,
+			Metadata: msg.Metadata,
+			EventID:  evt.ID,
+			Attempts: attempts,
+			Err:      err,
+		})
+		if dlErr == nil {
+			msg.Ack()
+			r.metrics.eventsDeadLettered.Inc()
+			logger(ctx).Info("Dead lettered message", "message", msg.LoggableID, "event", evt.ID, "attempts", attempts, "err", err)
+			return nil
+		}
+
+		err = fmt.Errorf("%w, failed to dead letter message: %s", err, dlErr.Error())
+	}
+
+	r.nack(msg, evt)
+	if r.continueOnError {
+		logger(ctx).Error(err, "Continuing after failure", "event", evt.ID, "type", evt.typeName(), "attempts", attempts)
+		return nil
+	}
+
+	return err
+}
+
+// shard returns the index of the queue that should handle events with the given key.
+func shard(key string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+// nack the message if the event bus supports it, invoking the nack hook if one is set.
+func (r *Reader) nack(msg *pubsub.Message, evt Event) {
+	if !msg.Nackable() {
+		return
+	}
+
+	msg.Nack()
+	if r.onNack != nil {
+		r.onNack(evt)
+	}
+}
+
+// drainContext returns a context.Context carrying the values of ctx that is cancelled once the timeout has elapsed
+// after ctx is done, or when the returned context.CancelFunc is called.
+func drainContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	drainCtx, cancel := context.WithCancel(detachedContext{parent: ctx})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-drainCtx.Done():
+			return
+		}
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			cancel()
+		case <-drainCtx.Done():
+		}
+	}()
+
+	return drainCtx, cancel
+}
+
+// The detachedContext type is a context.Context that carries the values of its parent, but is never cancelled and
+// has no deadline.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
 // Close the connection to the event stream.
 func (r *Reader) Close() error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
-	return r.subscription.Shutdown(ctx)
+
+	if err := r.subscription.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	if r.deadLetterTopic != nil {
+		if err := r.deadLetterTopic.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+
+	r.bucketMux.Lock()
+	defer r.bucketMux.Unlock()
+	for _, bucket := range r.buckets {
+		if err := bucket.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// errFiltered is returned by Reader.decode for events that do not match the filter set using WithFilter.
+var errFiltered = errors.New("event does not match filter")
+
+// decode the event from the message body and metadata. If the event is a claim check, the original event is fetched
+// from blob storage once the filter has been evaluated.
+func (r *Reader) decode(ctx context.Context, body []byte, metadata map[string]string) (Event, error) {
+	evt, err := decode(body, metadata)
+	if err != nil {
+		return Event{}, err
+	}
+
+	if r.filter != nil && !r.filter(evt) {
+		return Event{}, errFiltered
+	}
+
+	claim, ok := evt.Payload.(*event.ClaimCheck)
+	if !ok {
+		return evt, nil
+	}
+
+	bucket, err := r.bucket(ctx, claim.GetUrl())
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to open claim check bucket: %w", err)
+	}
+
+	body, err = bucket.ReadAll(ctx, claim.GetKey())
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to read claim check %s: %w", claim.GetKey(), err)
+	}
+
+	return decode(body, claim.GetMetadata())
+}
+
+func (r *Reader) bucket(ctx context.Context, urlStr string) (*blob.Bucket, error) {
+	r.bucketMux.Lock()
+	defer r.bucketMux.Unlock()
+
+	if bucket, ok := r.buckets[urlStr]; ok {
+		return bucket, nil
+	}
+
+	if !r.allowedBucket(urlStr) {
+		return nil, fmt.Errorf("claim check bucket %s is not allowed", urlStr)
+	}
+
+	bucket, err := blob.OpenBucket(ctx, urlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	r.buckets[urlStr] = bucket
+	return bucket, nil
+}
+
+// allowedBucket returns true if the URL was allowed using WithClaimCheckBucket.
+func (r *Reader) allowedBucket(urlStr string) bool {
+	for _, allowed := range r.claimCheckURLs {
+		if urlStr == allowed {
+			return true
+		}
+	}
+
+	return false
 }
 
 func consumerKey(msg *pubsub.Message) string {
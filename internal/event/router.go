@@ -0,0 +1,248 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+type (
+	// The Router type is used to write events to different topics based on a set of routes. Events that do not match
+	// any route are written to a fallback WriteCloser. Topics for each route are opened when the first event is routed to
+	// them.
+	Router struct {
+		routes   []route
+		fallback WriteCloser
+		opts     []WriterOption
+
+		writers   map[string]*routeWriter
+		writerMux *sync.Mutex
+	}
+
+	// The routeWriter type holds the Writer for a route's topic. It has its own lock so that opening the topic for
+	// one route does not block writing events to the others.
+	routeWriter struct {
+		mux    *sync.Mutex
+		writer *Writer
+	}
+
+	// The Route type describes the events that should be written to a topic. Each field is optional, an event must
+	// match all fields that are set to be written to the topic.
+	Route struct {
+		// The URL of the topic to write matching events to.
+		URL string `json:"url"`
+		// The API groups of resources to match.
+		Groups []string `json:"groups,omitempty"`
+		// The API versions of resources to match.
+		Versions []string `json:"versions,omitempty"`
+		// The kinds of resources to match.
+		Kinds []string `json:"kinds,omitempty"`
+		// The namespaces of resources to match.
+		Namespaces []string `json:"namespaces,omitempty"`
+		// A label selector that resources must match.
+		LabelSelector string `json:"labelSelector,omitempty"`
+		// The event types to match, see Event.Type for possible values.
+		Types []string `json:"types,omitempty"`
+		// The URL of the blob storage bucket that events written to the topic are claim checked to, so that events
+		// for restricted topics are not stored alongside all others. Defaults to the bucket set using WithClaimCheck.
+		ClaimCheckURL string `json:"claimCheckUrl,omitempty"`
+		// Whether events written to the topic are never claim checked, regardless of their size.
+		DisableClaimCheck bool `json:"disableClaimCheck,omitempty"`
+	}
+
+	route struct {
+		Route
+
+		selector labels.Selector
+	}
+)
+
+// NewRouter returns a new instance of the Router type that writes events to the first of the given routes they
+// match, or to the fallback WriteCloser if they match none. The provided options are used when opening the topic for
+// each route, other than the claim check bucket which can be replaced or disabled by each route.
+func NewRouter(fallback WriteCloser, routes []Route, opts ...WriterOption) (*Router, error) {
+	r := &Router{
+		routes:    make([]route, len(routes)),
+		fallback:  fallback,
+		opts:      opts,
+		writers:   make(map[string]*routeWriter),
+		writerMux: &sync.Mutex{},
+	}
+
+	// Routes with the same URL share a Writer, so must use the same claim check bucket.
+	urls := make(map[string]int)
+	for i, rt := range routes {
+		if rt.URL == "" {
+			return nil, fmt.Errorf("route %d has no url", i)
+		}
+
+		if rt.ClaimCheckURL != "" && rt.DisableClaimCheck {
+			return nil, fmt.Errorf("route %d cannot set a claim check url and disable claim checks", i)
+		}
+
+		if j, ok := urls[rt.URL]; ok && (routes[j].ClaimCheckURL != rt.ClaimCheckURL || routes[j].DisableClaimCheck != rt.DisableClaimCheck) {
+			return nil, fmt.Errorf("routes %d and %d have the same url but different claim check settings", j, i)
+		}
+		urls[rt.URL] = i
+
+		selector, err := labels.Parse(rt.LabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label selector for route %d: %w", i, err)
+		}
+
+		r.routes[i] = route{Route: rt, selector: selector}
+	}
+
+	return r, nil
+}
+
+// LoadRoutes reads routes from the YAML or JSON file at the given path. The file is expected to contain a list of
+// routes.
+func LoadRoutes(path string) ([]Route, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []Route
+	if err = yaml.UnmarshalStrict(data, &routes); err != nil {
+		return nil, fmt.Errorf("failed to parse routes: %w", err)
+	}
+
+	return routes, nil
+}
+
+// Write an event to the topic of the first route it matches.
+func (r *Router) Write(ctx context.Context, evt Event) error {
+	for _, rt := range r.routes {
+		if !rt.matches(evt) {
+			continue
+		}
+
+		writer, err := r.writer(ctx, rt)
+		if err != nil {
+			return fmt.Errorf("failed to open route topic: %w", err)
+		}
+
+		return writer.Write(ctx, evt)
+	}
+
+	return r.fallback.Write(ctx, evt)
+}
+
+// Close the fallback WriteCloser and any topics opened by the Router. All are closed even if some fail, the first
+// error encountered is returned.
+func (r *Router) Close() error {
+	r.writerMux.Lock()
+	defer r.writerMux.Unlock()
+
+	var err error
+	for _, rw := range r.writers {
+		if closeErr := rw.close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	if closeErr := r.fallback.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// writer returns the Writer for the route's topic, opening it if this is the first event routed to it or a previous
+// attempt to open it failed.
+func (r *Router) writer(ctx context.Context, rt route) (*Writer, error) {
+	r.writerMux.Lock()
+	rw, ok := r.writers[rt.URL]
+	if !ok {
+		rw = &routeWriter{mux: &sync.Mutex{}}
+		r.writers[rt.URL] = rw
+	}
+	r.writerMux.Unlock()
+
+	rw.mux.Lock()
+	defer rw.mux.Unlock()
+
+	if rw.writer != nil {
+		return rw.writer, nil
+	}
+
+	writer, err := NewWriter(ctx, rt.URL, rt.writerOptions(r.opts)...)
+	if err != nil {
+		return nil, err
+	}
+
+	rw.writer = writer
+	return writer, nil
+}
+
+func (rw *routeWriter) close() error {
+	rw.mux.Lock()
+	defer rw.mux.Unlock()
+
+	if rw.writer == nil {
+		return nil
+	}
+
+	return rw.writer.Close()
+}
+
+// writerOptions returns the options used to open the Writer for the route's topic, replacing the claim check bucket
+// if the route sets its own or disables claim checks.
+func (rt route) writerOptions(opts []WriterOption) []WriterOption {
+	switch {
+	case rt.DisableClaimCheck:
+		return append(opts[:len(opts):len(opts)], withClaimCheckBucket(""))
+	case rt.ClaimCheckURL != "":
+		return append(opts[:len(opts):len(opts)], withClaimCheckBucket(rt.ClaimCheckURL))
+	default:
+		return opts
+	}
+}
+
+func (rt route) matches(evt Event) bool {
+	attributes := evt.Attributes
+
+	switch {
+	case !MatchesAny(rt.Groups, attributes[AttributeGroup]):
+		return false
+	case !MatchesAny(rt.Versions, attributes[AttributeVersion]):
+		return false
+	case !MatchesAny(rt.Kinds, attributes[AttributeKind]):
+		return false
+	case !MatchesAny(rt.Namespaces, attributes[AttributeNamespace]):
+		return false
+	case !MatchesAny(rt.Types, evt.Type()):
+		return false
+	case rt.selector.Empty():
+		return true
+	}
+
+	set, err := labels.ConvertSelectorToLabelsMap(attributes[AttributeLabels])
+	if err != nil {
+		return false
+	}
+
+	return rt.selector.Matches(set)
+}
+
+// MatchesAny returns true if the value is one of the given values, or if no values are given. It is used to match
+// events against optional sets of attribute values, such as those of a Route.
+func MatchesAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
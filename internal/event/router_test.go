@@ -0,0 +1,209 @@
+package event_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/davidsbond/kollect/internal/event"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+func TestRouter_Write(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	routesFile := filepath.Join(t.TempDir(), "routes.yaml")
+	require.NoError(t, os.WriteFile(routesFile, []byte(`
+- url: mem://router-secrets
+  kinds: [Secret]
+- url: mem://router-production
+  namespaces: [production]
+  labelSelector: app=example
+  types: [created, updated]
+`), 0o600))
+
+	routes, err := event.LoadRoutes(routesFile)
+	require.NoError(t, err)
+
+	fallback, err := event.NewWriter(ctx, "mem://router-default")
+	require.NoError(t, err)
+
+	router, err := event.NewRouter(fallback, routes)
+	require.NoError(t, err)
+
+	tt := []struct {
+		Name        string
+		Payload     *resource.ResourceDeletedEvent
+		Attributes  map[string]string
+		ExpectedURL string
+	}{
+		{
+			Name: "It should route secrets to the secrets topic",
+			Attributes: map[string]string{
+				event.AttributeKind:      "Secret",
+				event.AttributeNamespace: "production",
+			},
+			ExpectedURL: "mem://router-secrets",
+		},
+		{
+			Name: "It should route events matching all fields of a route",
+			Attributes: map[string]string{
+				event.AttributeKind:      "Deployment",
+				event.AttributeNamespace: "production",
+				event.AttributeLabels:    "app=example,team=test",
+			},
+			ExpectedURL: "mem://router-production",
+		},
+		{
+			Name: "It should route events that do not match any route to the fallback",
+			Attributes: map[string]string{
+				event.AttributeKind:      "Deployment",
+				event.AttributeNamespace: "production",
+				event.AttributeLabels:    "app=other",
+			},
+			ExpectedURL: "mem://router-default",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			// In-memory subscriptions can only be opened for existing topics. The topic is shared with the router,
+			// which is responsible for shutting it down.
+			_, err := pubsub.OpenTopic(ctx, tc.ExpectedURL)
+			require.NoError(t, err)
+
+			subscription, err := pubsub.OpenSubscription(ctx, tc.ExpectedURL)
+			require.NoError(t, err)
+			defer subscription.Shutdown(ctx)
+
+			evt := event.New(&resource.ResourceCreatedEvent{Uid: "test"}, event.WithAttributes(tc.Attributes))
+			require.NoError(t, router.Write(ctx, evt))
+
+			msg, err := subscription.Receive(ctx)
+			require.NoError(t, err)
+			msg.Ack()
+
+			assert.NotEmpty(t, msg.Body)
+		})
+	}
+
+	require.NoError(t, router.Close())
+}
+
+func TestRouter_Close(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	fallback, err := event.NewWriter(ctx, "mem://router-close-default")
+	require.NoError(t, err)
+
+	router, err := event.NewRouter(fallback, []event.Route{{URL: "mem://router-close-route"}})
+	require.NoError(t, err)
+
+	require.NoError(t, router.Write(ctx, event.New(&resource.ResourceCreatedEvent{Uid: "test"})))
+
+	// Shutting down the route's topic first causes the router to fail to close it, the fallback should still be
+	// closed.
+	topic, err := pubsub.OpenTopic(ctx, "mem://router-close-route")
+	require.NoError(t, err)
+	require.NoError(t, topic.Shutdown(ctx))
+
+	assert.Error(t, router.Close())
+	assert.Error(t, fallback.Write(ctx, event.New(&resource.ResourceCreatedEvent{Uid: "test"})))
+}
+
+func TestRouter_WriteClaimCheck(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var (
+		sharedBucket     = t.TempDir()
+		restrictedBucket = t.TempDir()
+	)
+
+	fallback, err := event.NewWriter(ctx, "mem://router-claim-check-default")
+	require.NoError(t, err)
+
+	router, err := event.NewRouter(fallback, []event.Route{
+		{URL: "mem://router-claim-check-restricted", Kinds: []string{"Secret"}, ClaimCheckURL: "file://" + restrictedBucket},
+		{URL: "mem://router-claim-check-disabled", Kinds: []string{"ConfigMap"}, DisableClaimCheck: true},
+		{URL: "mem://router-claim-check-shared"},
+	}, event.WithClaimCheck("file://"+sharedBucket, 0))
+	require.NoError(t, err)
+
+	tt := []struct {
+		Name           string
+		Kind           string
+		URL            string
+		ExpectedBucket string
+	}{
+		{
+			Name:           "It should claim check events using the route's bucket",
+			Kind:           "Secret",
+			URL:            "mem://router-claim-check-restricted",
+			ExpectedBucket: restrictedBucket,
+		},
+		{
+			Name: "It should not claim check events for routes with claim checks disabled",
+			Kind: "ConfigMap",
+			URL:  "mem://router-claim-check-disabled",
+		},
+		{
+			Name:           "It should claim check events using the shared bucket by default",
+			Kind:           "Deployment",
+			URL:            "mem://router-claim-check-shared",
+			ExpectedBucket: sharedBucket,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := pubsub.OpenTopic(ctx, tc.URL)
+			require.NoError(t, err)
+
+			reader, err := event.NewReader(ctx, tc.URL,
+				event.WithClaimCheckBucket("file://"+sharedBucket),
+				event.WithClaimCheckBucket("file://"+restrictedBucket),
+			)
+			require.NoError(t, err)
+
+			evt := event.New(&resource.ResourceCreatedEvent{Uid: tc.Kind}, event.WithAttributes(map[string]string{
+				event.AttributeKind: tc.Kind,
+			}))
+			require.NoError(t, router.Write(ctx, evt))
+
+			for _, bucket := range []string{sharedBucket, restrictedBucket} {
+				_, err = os.Stat(filepath.Join(bucket, evt.ID))
+				if bucket == tc.ExpectedBucket {
+					assert.NoError(t, err)
+				} else {
+					assert.True(t, os.IsNotExist(err))
+				}
+			}
+
+			readCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+
+			err = reader.Read(readCtx, func(ctx context.Context, actual event.Event) error {
+				cancel()
+				assert.True(t, proto.Equal(evt.Payload, actual.Payload))
+				return nil
+			})
+
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+		})
+	}
+
+	require.NoError(t, router.Close())
+}
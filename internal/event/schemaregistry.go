@@ -0,0 +1,77 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/davidsbond/kollect/internal/schemaregistry"
+	"github.com/davidsbond/kollect/proto/kollect/event/v1"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+// The magic byte that prefixes messages framed using the schema registry wire format.
+const schemaRegistryMagicByte = 0x0
+
+// registerSchemas registers the protobuf schemas for the event envelope and resource events with the schema registry.
+// The envelope is registered using the topic name strategy. The resource events, which are contained within the
+// envelope's payload, are registered using the topic record name strategy.
+func (w *Writer) registerSchemas(ctx context.Context, registry *schemaregistry.Client, topic string) error {
+	id, err := registry.Register(ctx, topic+"-value", event.Schema)
+	if err != nil {
+		return err
+	}
+
+	payloads := []proto.Message{
+		&resource.ResourceCreatedEvent{},
+		&resource.ResourceUpdatedEvent{},
+		&resource.ResourceDeletedEvent{},
+	}
+
+	for _, payload := range payloads {
+		subject := topic + "-" + string(payload.ProtoReflect().Descriptor().FullName())
+		if _, err = registry.Register(ctx, subject, resource.Schema); err != nil {
+			return err
+		}
+	}
+
+	w.schemaID = id
+	return nil
+}
+
+// frame prefixes the body with the schema registry wire format header. This is the magic byte, followed by the
+// big-endian schema identifier and the indexes of the message within the schema.
+func frame(schemaID int, body []byte) []byte {
+	header := make([]byte, 6)
+	header[0] = schemaRegistryMagicByte
+	binary.BigEndian.PutUint32(header[1:5], uint32(schemaID))
+
+	// The Envelope is the first message within its schema, whose indexes are encoded as a single zero byte.
+	header[5] = 0
+
+	return append(header, body...)
+}
+
+// unframe removes the schema registry wire format header from the body. If the body is not framed, it is returned
+// unmodified. A protobuf-encoded Envelope never begins with a zero byte, so cannot be mistaken for a framed message.
+func unframe(body []byte) ([]byte, error) {
+	if len(body) < 6 || body[0] != schemaRegistryMagicByte {
+		return body, nil
+	}
+
+	r := bytes.NewReader(body[5:])
+	count, err := binary.ReadVarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := int64(0); i < count; i++ {
+		if _, err = binary.ReadVarint(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return body[len(body)-r.Len():], nil
+}
@@ -0,0 +1,123 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/davidsbond/kollect/internal/schemaregistry"
+	"github.com/davidsbond/kollect/proto/kollect/event/v1"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+type (
+	fakeSchemaRegistry struct {
+		mux      sync.Mutex
+		schemas  []string
+		subjects map[string]int
+	}
+)
+
+func (f *fakeSchemaRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	subject := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/subjects/"), "/versions")
+	if r.Method != http.MethodPost || subject == r.URL.Path {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var request struct {
+		SchemaType string `json:"schemaType"`
+		Schema     string `json:"schema"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.SchemaType != "PROTOBUF" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"error_code": 42201, "message": "Invalid schema"})
+		return
+	}
+
+	id := 0
+	for i, schema := range f.schemas {
+		if schema == request.Schema {
+			id = i + 1
+		}
+	}
+
+	if id == 0 {
+		f.schemas = append(f.schemas, request.Schema)
+		id = len(f.schemas)
+	}
+
+	f.subjects[subject] = id
+	_ = json.NewEncoder(w).Encode(map[string]int{"id": id})
+}
+
+func TestWriter_SchemaRegistry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	registry := &fakeSchemaRegistry{subjects: make(map[string]int)}
+	svr := httptest.NewServer(registry)
+	defer svr.Close()
+
+	client, err := schemaregistry.New(svr.URL)
+	require.NoError(t, err)
+
+	writer, err := NewWriter(ctx, "mem://schema-registry")
+	require.NoError(t, err)
+	require.NoError(t, writer.registerSchemas(ctx, client, "test"))
+
+	assert.EqualValues(t, map[string]int{
+		"test-value": 1,
+		"test-kollect.resource.event.v1.ResourceCreatedEvent": 2,
+		"test-kollect.resource.event.v1.ResourceUpdatedEvent": 2,
+		"test-kollect.resource.event.v1.ResourceDeletedEvent": 2,
+	}, registry.subjects)
+	assert.EqualValues(t, event.Schema, registry.schemas[0])
+	assert.EqualValues(t, resource.Schema, registry.schemas[1])
+
+	subscription, err := pubsub.OpenSubscription(ctx, "mem://schema-registry")
+	require.NoError(t, err)
+
+	expected := New(&resource.ResourceDeletedEvent{Uid: "test", ClusterId: "test"})
+	require.NoError(t, writer.Write(ctx, expected))
+
+	msg, err := subscription.Receive(ctx)
+	require.NoError(t, err)
+	msg.Ack()
+
+	// Magic byte, followed by the schema identifier and the message indexes.
+	assert.EqualValues(t, []byte{0, 0, 0, 0, 1, 0}, msg.Body[:6])
+
+	actual, err := decode(msg.Body, msg.Metadata)
+	require.NoError(t, err)
+	assert.EqualValues(t, expected.ID, actual.ID)
+	assert.True(t, proto.Equal(expected.Payload, actual.Payload))
+
+	require.NoError(t, subscription.Shutdown(ctx))
+	require.NoError(t, writer.Close())
+}
+
+func TestNewWriter_SchemaRegistryUnsupported(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	_, err := NewWriter(ctx, "mem://schema-registry-unsupported", WithSchemaRegistry("http://localhost"))
+	assert.Error(t, err)
+
+	_, err = NewWriter(ctx, "kafka://schema-registry-unsupported?encoding=json", WithSchemaRegistry("http://localhost"))
+	assert.Error(t, err)
+}
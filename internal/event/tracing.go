@@ -0,0 +1,78 @@
+package event
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/davidsbond/kollect/internal/tracing"
+)
+
+// Attribute keys used for spans describing individual events.
+const (
+	spanAttributeType = attribute.Key("kollect.event.type")
+	spanAttributeKey  = attribute.Key("kollect.event.key")
+)
+
+// WithWriterTracerProvider returns a WriterOption that sets the trace.TracerProvider used to create spans for
+// events written by the Writer. Defaults to the global trace.TracerProvider.
+func WithWriterTracerProvider(provider trace.TracerProvider) WriterOption {
+	return func(w *Writer) {
+		w.tracer = tracing.Tracer(provider)
+	}
+}
+
+// WithReaderTracerProvider returns a ReaderOption that sets the trace.TracerProvider used to create spans for
+// events read by the Reader. Defaults to the global trace.TracerProvider.
+func WithReaderTracerProvider(provider trace.TracerProvider) ReaderOption {
+	return func(r *Reader) {
+		r.tracer = tracing.Tracer(provider)
+	}
+}
+
+// spanAttributes returns the span attributes that describe the event.
+func spanAttributes(evt Event, destination string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.MessagingDestinationKey.String(destination),
+		semconv.MessagingMessageIDKey.String(evt.ID),
+		spanAttributeType.String(evt.Type()),
+		spanAttributeKey.String(evt.Key),
+	}
+}
+
+// startSpan starts a span for processing the message, whose parent is the span that wrote the message, if any.
+func (r *Reader) startSpan(ctx context.Context, d delivery) (context.Context, trace.Span) {
+	ctx = tracing.Extract(ctx, d.msg.Metadata)
+	return r.tracer.Start(ctx, r.name+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(spanAttributes(d.evt, r.name)...),
+	)
+}
+
+// startBatchSpan starts a span for processing a batch of messages, linked to the spans that wrote each message.
+// Each message may have been written as part of a different trace, so they are linked rather than used as parents.
+func (r *Reader) startBatchSpan(ctx context.Context, batch []delivery) (context.Context, trace.Span) {
+	links := make([]trace.Link, 0, len(batch))
+	for _, d := range batch {
+		sc := trace.SpanContextFromContext(tracing.Extract(context.Background(), d.msg.Metadata))
+		if !sc.IsValid() {
+			continue
+		}
+
+		links = append(links, trace.Link{
+			SpanContext: sc,
+			Attributes:  spanAttributes(d.evt, r.name),
+		})
+	}
+
+	return r.tracer.Start(ctx, r.name+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			semconv.MessagingDestinationKey.String(r.name),
+			attribute.Int("kollect.batch.size", len(batch)),
+		),
+	)
+}
@@ -0,0 +1,85 @@
+package event_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/davidsbond/kollect/internal/event"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+func TestReader_ReadTracing(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name     string
+		Encoding event.Encoding
+	}{
+		{Name: "It should propagate trace context for protobuf events", Encoding: event.EncodingProto},
+		{Name: "It should propagate trace context for JSON events", Encoding: event.EncodingJSON},
+		{Name: "It should propagate trace context for structured CloudEvents", Encoding: event.EncodingCloudEventsStructured},
+		{Name: "It should propagate trace context for binary CloudEvents", Encoding: event.EncodingCloudEventsBinary},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+			url := "mem://tracing-" + string(tc.Encoding)
+			writer, err := event.NewWriter(ctx, url,
+				event.WithEncoding(tc.Encoding),
+				event.WithWriterTracerProvider(provider),
+			)
+			require.NoError(t, err)
+
+			reader, err := event.NewReader(ctx, url, event.WithReaderTracerProvider(provider))
+			require.NoError(t, err)
+
+			parentCtx, parent := provider.Tracer("test").Start(ctx, "parent")
+			require.NoError(t, writer.Write(parentCtx, event.New(&resource.ResourceDeletedEvent{
+				Uid:       "test",
+				ClusterId: "test",
+			})))
+			parent.End()
+
+			var actual trace.SpanContext
+			err = reader.Read(ctx, func(ctx context.Context, evt event.Event) error {
+				cancel()
+				actual = trace.SpanContextFromContext(ctx)
+				return nil
+			})
+
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+			require.NoError(t, writer.Close())
+
+			spans := make(map[string]sdktrace.ReadOnlySpan)
+			for _, span := range recorder.Ended() {
+				spans[span.Name()] = span
+			}
+
+			require.Contains(t, spans, url+" send")
+			require.Contains(t, spans, url+" process")
+
+			send, process := spans[url+" send"], spans[url+" process"]
+			assert.Equal(t, trace.SpanKindProducer, send.SpanKind())
+			assert.Equal(t, parent.SpanContext().SpanID(), send.Parent().SpanID())
+			assert.Equal(t, trace.SpanKindConsumer, process.SpanKind())
+			assert.Equal(t, send.SpanContext().SpanID(), process.Parent().SpanID())
+			assert.True(t, process.Parent().IsRemote())
+
+			assert.Equal(t, parent.SpanContext().TraceID(), actual.TraceID())
+			assert.Equal(t, process.SpanContext().SpanID(), actual.SpanID())
+		})
+	}
+}
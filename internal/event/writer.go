@@ -2,38 +2,237 @@ package event
 
 import (
 	"context"
+	"fmt"
+	"net/url"
 	"time"
 
 	servicebus "github.com/Azure/azure-service-bus-go"
 	"github.com/Shopify/sarama"
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/trace"
+	"gocloud.dev/blob"
 	"gocloud.dev/pubsub"
+	"gocloud.dev/pubsub/kafkapubsub"
 	gcppubsub "google.golang.org/genproto/googleapis/pubsub/v1"
+
+	"github.com/davidsbond/kollect/internal/metrics"
+	"github.com/davidsbond/kollect/internal/schemaregistry"
+	"github.com/davidsbond/kollect/internal/tracing"
+	"github.com/davidsbond/kollect/proto/kollect/event/v1"
 )
 
 type (
 	// The Writer type is used to write events to a single topic.
 	Writer struct {
-		topic *pubsub.Topic
+		name       string
+		topic      *pubsub.Topic
+		encoding   Encoding
+		dataFormat DataFormat
+
+		// The prefix of the message metadata keys CloudEvent attributes are written to when using
+		// EncodingCloudEventsBinary, determined by the scheme of the event bus URL.
+		cloudEventsPrefix string
+
+		// Blob storage bucket used to store events whose size exceeds the claim check threshold. Only set when
+		// the WithClaimCheck option is used.
+		bucket              *blob.Bucket
+		bucketURL           string
+		claimCheckThreshold int
+
+		// The identifier of the envelope schema within the schema registry, messages are framed using the schema
+		// registry wire format when set. Only set when the WithSchemaRegistry option is used.
+		schemaID          int
+		schemaRegistryURL string
+
+		metricsConfig metrics.Config
+		metrics       *writerMetrics
+		tracer        trace.Tracer
+	}
+
+	// The WriterOption type is a function that can modify the behaviour of a Writer.
+	WriterOption func(w *Writer)
+
+	// The WriteCloser interface describes types that write events to one or more event streams and can be closed,
+	// such as the Writer, Router and MultiWriter types.
+	WriteCloser interface {
+		Write(ctx context.Context, evt Event) error
+		Close() error
 	}
 )
 
+// The URL query parameter that can be used to set the Encoding of a Writer, it is removed from the URL before the
+// topic is opened.
+const encodingParam = "encoding"
+
+// DefaultClaimCheckThreshold is the size, in bytes, above which events are claim checked when a claim check bucket is
+// set without a threshold, such as for a Route with its own claim check bucket.
+const DefaultClaimCheckThreshold = 256 * 1024
+
 // NewWriter creates a new instance of the Writer type that will write events to the configured
-// event stream provider identified using the given URL.
-func NewWriter(ctx context.Context, urlStr string) (*Writer, error) {
+// event stream provider identified using the given URL. The encoding used by the Writer can be set using the
+// "encoding" query parameter, which takes precedence over the WithEncoding option.
+func NewWriter(ctx context.Context, urlStr string, opts ...WriterOption) (*Writer, error) {
+	w := &Writer{
+		name:                sinkName(urlStr),
+		encoding:            EncodingProto,
+		dataFormat:          DataFormatJSON,
+		claimCheckThreshold: DefaultClaimCheckThreshold,
+		tracer:              tracing.Tracer(nil),
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	w.cloudEventsPrefix = cloudEventsPrefix(u.Scheme)
+	if query := u.Query(); query.Has(encodingParam) {
+		w.encoding = Encoding(query.Get(encodingParam))
+		query.Del(encodingParam)
+		u.RawQuery = query.Encode()
+		urlStr = u.String()
+	}
+
+	w.metrics, err = newWriterMetrics(w.metricsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if !w.encoding.valid() {
+		return nil, fmt.Errorf("unsupported encoding %q", w.encoding)
+	}
+
+	if !w.dataFormat.valid() {
+		return nil, fmt.Errorf("unsupported data format %q", w.dataFormat)
+	}
+
+	if w.schemaRegistryURL != "" {
+		if u.Scheme != kafkapubsub.Scheme {
+			return nil, fmt.Errorf("schema registry is not supported for scheme %q", u.Scheme)
+		}
+
+		if w.encoding != EncodingProto {
+			return nil, fmt.Errorf("schema registry is not supported for encoding %q", w.encoding)
+		}
+
+		registry, err := schemaregistry.New(w.schemaRegistryURL)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = w.registerSchemas(ctx, registry, u.Host); err != nil {
+			return nil, err
+		}
+	}
+
+	if w.bucketURL != "" {
+		bucket, err := blob.OpenBucket(ctx, w.bucketURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open claim check bucket: %w", err)
+		}
+
+		w.bucket = bucket
+	}
+
 	topic, err := pubsub.OpenTopic(ctx, urlStr)
-	return &Writer{topic: topic}, err
+	if err != nil {
+		if w.bucket != nil {
+			// The error opening the topic takes precedence over any error closing the bucket.
+			_ = w.bucket.Close()
+		}
+
+		return nil, err
+	}
+
+	w.topic = topic
+	return w, nil
 }
 
-// Write an event to the stream.
+// WithSchemaRegistry returns a WriterOption that configures the Writer to register event schemas with the
+// Confluent-compatible schema registry at the given URL and to frame messages using the schema registry wire
+// format. This option is only supported for Apache Kafka using the protobuf encoding.
+func WithSchemaRegistry(urlStr string) WriterOption {
+	return func(w *Writer) {
+		w.schemaRegistryURL = urlStr
+	}
+}
+
+// WithClaimCheck returns a WriterOption that configures the Writer to store events whose encoded size exceeds
+// the threshold (in bytes) in the blob storage bucket identified using the given URL. In place of the original
+// event, a reference to the blob is published which the Reader will use to fetch the original event.
+func WithClaimCheck(urlStr string, threshold int) WriterOption {
+	return func(w *Writer) {
+		w.bucketURL = urlStr
+		w.claimCheckThreshold = threshold
+	}
+}
+
+// withClaimCheckBucket returns a WriterOption that replaces the blob storage bucket events are claim checked to,
+// keeping the threshold set by WithClaimCheck. A blank URL disables claim checks.
+func withClaimCheckBucket(urlStr string) WriterOption {
+	return func(w *Writer) {
+		w.bucketURL = urlStr
+	}
+}
+
+// WithEncoding returns a WriterOption that sets the Encoding used when writing events to the stream. Defaults to
+// EncodingProto.
+func WithEncoding(enc Encoding) WriterOption {
+	return func(w *Writer) {
+		w.encoding = enc
+	}
+}
+
+// WithDataFormat returns a WriterOption that sets the DataFormat used to encode event payloads when using one of
+// the CloudEvents encodings. Defaults to DataFormatJSON.
+func WithDataFormat(df DataFormat) WriterOption {
+	return func(w *Writer) {
+		w.dataFormat = df
+	}
+}
+
+// Write an event to the stream. The trace context of the span created for the write is added to the message
+// metadata, so that consumers can continue the trace.
 func (w *Writer) Write(ctx context.Context, evt Event) error {
-	body, err := evt.marshal()
+	ctx, span := w.tracer.Start(ctx, w.name+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(spanAttributes(evt, w.name)...),
+	)
+	defer span.End()
+
+	if err := w.write(ctx, evt); err != nil {
+		tracing.Fail(span, err)
+		return err
+	}
+
+	return nil
+}
+
+func (w *Writer) write(ctx context.Context, evt Event) error {
+	start := time.Now()
+	body, metadata, err := evt.encode(w.encoding, w.dataFormat, w.cloudEventsPrefix)
 	if err != nil {
 		return err
 	}
 
+	if w.bucket != nil && len(body) > w.claimCheckThreshold {
+		body, metadata, err = w.claimCheck(ctx, evt, body, metadata)
+		if err != nil {
+			return fmt.Errorf("failed to claim check event %s: %w", evt.ID, err)
+		}
+	}
+
+	if w.schemaID != 0 {
+		body = frame(w.schemaID, body)
+	}
+
 	err = w.topic.Send(ctx, &pubsub.Message{
 		Body:       body,
+		Metadata:   tracing.Inject(ctx, metadata),
 		BeforeSend: producerKeyFunc(evt.Key),
 	})
 
@@ -41,7 +240,8 @@ func (w *Writer) Write(ctx context.Context, evt Event) error {
 		return err
 	}
 
-	eventsWritten.WithLabelValues(evt.Key, evt.typeName()).Inc()
+	w.metrics.published(evt, w.name, len(body), time.Since(start).Seconds())
+	logger(ctx).V(4).Info("Published event", "event", evt.ID, "type", evt.typeName(), "key", evt.Key, "sink", w.name, "size", len(body))
 	return nil
 }
 
@@ -50,7 +250,48 @@ func (w *Writer) Close() error {
 	const timeout = time.Second * 10
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	return w.topic.Shutdown(ctx)
+
+	err := w.topic.Shutdown(ctx)
+	if w.bucket != nil {
+		if bucketErr := w.bucket.Close(); err == nil {
+			err = bucketErr
+		}
+	}
+
+	return err
+}
+
+// claimCheck writes the encoded event to the blob storage bucket and returns an encoded event whose payload
+// references the blob, rather than containing the original payload.
+func (w *Writer) claimCheck(ctx context.Context, evt Event, body []byte, metadata map[string]string) ([]byte, map[string]string, error) {
+	contentType := metadata[contentTypeKey]
+	if contentType == "" {
+		contentType = contentTypeProto
+	}
+
+	key := evt.ID
+	err := w.bucket.WriteAll(ctx, key, body, &blob.WriterOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ref := evt
+	ref.Payload = &event.ClaimCheck{
+		Url:      w.bucketURL,
+		Key:      key,
+		Metadata: metadata,
+	}
+
+	body, metadata, err = ref.encode(w.encoding, w.dataFormat, w.cloudEventsPrefix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w.metrics.eventsClaimChecked.WithLabelValues(evt.typeName()).Inc()
+	logger(ctx).V(2).Info("Claim checked event", "event", evt.ID, "type", evt.typeName(), "blob", key)
+	return body, metadata, nil
 }
 
 // producerKeyFunc implements the pubsub.Message.BeforeSend function and is used to appropriately set the message key before
@@ -0,0 +1,95 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/record"
+)
+
+// EventRecorder returns a record.EventRecorder that records events in the cluster on behalf of the named component,
+// and a function that stops recording events.
+func EventRecorder(config *rest.Config, component string) (record.EventRecorder, func(), error) {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component})
+	return recorder, broadcaster.Shutdown, nil
+}
+
+// ObjectReference returns a reference to an object within the cluster, which can be used as the subject of events.
+// The object is described in the form <resource>/<name>, where the resource can be qualified by version and group
+// as in "pods/example", "deployments.apps/example" or "deployments.v1.apps/example". The namespace is ignored for
+// cluster-scoped resources.
+func ObjectReference(ctx context.Context, config *rest.Config, namespace, object string) (*corev1.ObjectReference, error) {
+	parts := strings.SplitN(object, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("object %q must be in the form <resource>/<name>", object)
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(client.Discovery()))
+
+	gvr, gr := schema.ParseResourceArg(parts[0])
+	if gvr == nil {
+		gvr = &schema.GroupVersionResource{Group: gr.Group, Resource: gr.Resource}
+	}
+
+	gvk, err := mapper.KindFor(*gvr)
+	if err != nil && gvr.Version != "" {
+		// The resource could not be found using the version, so it may be a resource in a group containing dots.
+		gvk, err = mapper.KindFor(gr.WithVersion(""))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find resource %s: %w", parts[0], err)
+	}
+
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find resource %s: %w", parts[0], err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var resource dynamic.ResourceInterface = dynamicClient.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		resource = dynamicClient.Resource(mapping.Resource).Namespace(namespace)
+	}
+
+	obj, err := resource.Get(ctx, parts[1], metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", object, err)
+	}
+
+	return &corev1.ObjectReference{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		UID:        obj.GetUID(),
+	}, nil
+}
@@ -0,0 +1,178 @@
+// Package logging provides types/functions for configuring the format and verbosity of structured logs written via
+// klog and logr.
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/zapr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/klog/v2"
+)
+
+type (
+	// The Format type describes how log entries are written.
+	Format string
+
+	// The Config type describes how logs are written.
+	Config struct {
+		// The format log entries are written in. Defaults to FormatText.
+		Format Format
+		// The verbosity of log entries written by components without a verbosity in Components. Entries logged at a
+		// level greater than the verbosity are discarded.
+		Verbosity int
+		// The verbosity of log entries written by individual components, keyed by component name, such as those given
+		// using --log-component-verbosity. Components are identified using the last name given to the logger, each
+		// package names its logger after itself, such as "agent", "event" or "kollect", so that its verbosity can be
+		// set independently of the others.
+		Components map[string]int
+	}
+
+	// The filter type is a logr.LogSink that discards entries whose level exceeds the verbosity of the component
+	// that logged them.
+	filter struct {
+		sink       logr.LogSink
+		component  string
+		verbosity  int
+		components map[string]int
+	}
+)
+
+// Constants for supported log formats.
+const (
+	FormatText = Format("text")
+	FormatJSON = Format("json")
+)
+
+// New returns a logr.Logger that writes entries to w as described by the Config, and a function that flushes any
+// buffered entries. Log entries written via klog, including those of the kubernetes client, are also written using
+// the returned logr.Logger.
+//
+// When using FormatText, entries are written in the klog text format and w is ignored, as klog writes to stderr.
+// Entries written via klog's global functions are written if their level does not exceed the greatest verbosity of
+// any component.
+func New(config Config, w io.Writer) (logr.Logger, func(), error) {
+	if err := setKlogVerbosity(config.max()); err != nil {
+		return logr.Logger{}, nil, err
+	}
+
+	switch config.Format {
+	case FormatText, "":
+		// The klog text format cannot be used as klog's logger, as klog would end up writing each entry to itself.
+		// Entries written via klog's global functions are therefore filtered using the greatest verbosity.
+		return logr.New(config.filter(klog.NewKlogr().GetSink())), klog.Flush, nil
+	case FormatJSON:
+		encoder := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+
+		// Verbosity is determined by the filter, so the core must allow all levels. The zapr package maps each logr
+		// verbosity level to a negative zap level.
+		core := zapcore.NewCore(encoder, zapcore.AddSync(w), zapcore.Level(-127))
+
+		zl := zap.New(core)
+		logger := logr.New(config.filter(zapr.NewLogger(zl).GetSink()))
+		flush := func() {
+			_ = zl.Sync()
+		}
+
+		klog.SetLoggerWithOptions(logger, klog.ContextualLogger(true), klog.FlushLogger(flush))
+		return logger, flush, nil
+	default:
+		return logr.Logger{}, nil, fmt.Errorf("unsupported log format %q", config.Format)
+	}
+}
+
+// max returns the greatest verbosity of any component, so that klog does not discard entries before they are
+// filtered.
+func (c Config) max() int {
+	verbosity := c.Verbosity
+	for _, v := range c.Components {
+		if v > verbosity {
+			verbosity = v
+		}
+	}
+
+	return verbosity
+}
+
+func (c Config) filter(sink logr.LogSink) *filter {
+	// The sink has already been initialised by the logr.Logger it was taken from, so only the call frame added by the
+	// filter needs to be skipped when determining the caller of an entry.
+	if s, ok := sink.(logr.CallDepthLogSink); ok {
+		sink = s.WithCallDepth(1)
+	}
+
+	return &filter{
+		sink:       sink,
+		verbosity:  c.Verbosity,
+		components: c.Components,
+	}
+}
+
+// setKlogVerbosity sets the verbosity used by klog, which applies to entries written via klog's global functions and
+// the klog text format.
+func setKlogVerbosity(verbosity int) error {
+	flags := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(flags)
+
+	if err := flags.Set("v", strconv.Itoa(verbosity)); err != nil {
+		return fmt.Errorf("failed to set klog verbosity: %w", err)
+	}
+
+	return nil
+}
+
+// Init does nothing, as the underlying logr.LogSink is initialised when the filter is created.
+func (f *filter) Init(logr.RuntimeInfo) {}
+
+// Enabled returns true if entries at the given level should be written for the logger's component.
+func (f *filter) Enabled(level int) bool {
+	verbosity, ok := f.components[f.component]
+	if !ok {
+		verbosity = f.verbosity
+	}
+
+	return level <= verbosity && f.sink.Enabled(level)
+}
+
+// Info writes an informational entry.
+func (f *filter) Info(level int, msg string, kv ...interface{}) {
+	f.sink.Info(level, msg, kv...)
+}
+
+// Error writes an error entry, these are written regardless of verbosity.
+func (f *filter) Error(err error, msg string, kv ...interface{}) {
+	f.sink.Error(err, msg, kv...)
+}
+
+// WithValues returns a logr.LogSink that includes the key/value pairs in every entry.
+func (f *filter) WithValues(kv ...interface{}) logr.LogSink {
+	out := *f
+	out.sink = f.sink.WithValues(kv...)
+	return &out
+}
+
+// WithName returns a logr.LogSink with the name appended. The name identifies the component, so entries are
+// filtered using the verbosity of the most specific component.
+func (f *filter) WithName(name string) logr.LogSink {
+	out := *f
+	out.sink = f.sink.WithName(name)
+	out.component = name
+	return &out
+}
+
+// WithCallDepth returns a logr.LogSink that skips additional call frames when determining the caller of an entry.
+func (f *filter) WithCallDepth(depth int) logr.LogSink {
+	sink, ok := f.sink.(logr.CallDepthLogSink)
+	if !ok {
+		return f
+	}
+
+	out := *f
+	out.sink = sink.WithCallDepth(depth)
+	return &out
+}
@@ -0,0 +1,78 @@
+package logging_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/klog/v2"
+
+	"github.com/davidsbond/kollect/internal/logging"
+)
+
+func TestNew(t *testing.T) {
+	tt := []struct {
+		Name     string
+		Config   logging.Config
+		Expected []string
+	}{
+		{
+			Name:     "It should only write errors at the default verbosity",
+			Config:   logging.Config{Format: logging.FormatJSON},
+			Expected: []string{"agent error", "event error"},
+		},
+		{
+			Name:     "It should write entries up to the verbosity",
+			Config:   logging.Config{Format: logging.FormatJSON, Verbosity: 2},
+			Expected: []string{"agent info", "agent error", "event info", "event error"},
+		},
+		{
+			Name: "It should write entries up to the verbosity of each component",
+			Config: logging.Config{
+				Format:     logging.FormatJSON,
+				Components: map[string]int{"event": 4},
+			},
+			Expected: []string{"agent error", "event info", "event debug", "event error"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			defer klog.ClearLogger()
+
+			buf := bytes.NewBuffer(nil)
+			logger, flush, err := logging.New(tc.Config, buf)
+			require.NoError(t, err)
+
+			for _, name := range []string{"agent", "event"} {
+				named := logger.WithName("kollect").WithName(name)
+				named.V(2).Info(name + " info")
+				named.V(4).Info(name + " debug")
+				named.Error(errors.New("test"), name+" error")
+			}
+			flush()
+
+			var actual []string
+			scanner := bufio.NewScanner(buf)
+			for scanner.Scan() {
+				var entry struct {
+					Msg string `json:"msg"`
+				}
+
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+				actual = append(actual, entry.Msg)
+			}
+
+			assert.Equal(t, tc.Expected, actual)
+		})
+	}
+}
+
+func TestNew_UnsupportedFormat(t *testing.T) {
+	_, _, err := logging.New(logging.Config{Format: "xml"}, nil)
+	assert.EqualError(t, err, `unsupported log format "xml"`)
+}
@@ -0,0 +1,177 @@
+// Package metrics provides types/functions for creating prometheus metrics and registering them with a configurable
+// prometheus.Registerer.
+package metrics
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The Config type describes how metrics are named and where they are registered.
+type Config struct {
+	// The registerer metrics are registered with. When nil, metrics are still recorded but are not registered.
+	Registerer prometheus.Registerer
+	// The namespace metric names are prefixed with. Defaults to DefaultNamespace.
+	Namespace string
+	// Labels added to all metrics.
+	ConstLabels prometheus.Labels
+	// If true, metrics describing events are also labelled by the namespace of the resource. This can greatly
+	// increase the number of series for clusters with many namespaces.
+	NamespaceLabel bool
+	// If true, deprecated metrics labelled by event key are also recorded, for compatibility with existing
+	// dashboards and alerts. These metrics create a series per resource, so should only be enabled while migrating.
+	Legacy bool
+}
+
+// DefaultNamespace is the namespace used for metric names when one is not set.
+const DefaultNamespace = "kollect"
+
+// NewCounter returns a new prometheus.Counter, registered with the Config's registerer. If an identical counter
+// is already registered, it is returned instead.
+func (c Config) NewCounter(subsystem, name, help string) (prometheus.Counter, error) {
+	counter := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   c.namespace(),
+		Subsystem:   subsystem,
+		Name:        name,
+		Help:        help,
+		ConstLabels: c.ConstLabels,
+	})
+
+	existing, err := c.register(counter)
+	if err != nil {
+		return nil, err
+	}
+
+	if v, ok := existing.(prometheus.Counter); ok {
+		return v, nil
+	}
+
+	return nil, alreadyRegistered(existing, counter)
+}
+
+// NewCounterVec returns a new prometheus.CounterVec, registered with the Config's registerer. If an identical
+// counter is already registered, it is returned instead.
+func (c Config) NewCounterVec(subsystem, name, help string, labels []string) (*prometheus.CounterVec, error) {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   c.namespace(),
+		Subsystem:   subsystem,
+		Name:        name,
+		Help:        help,
+		ConstLabels: c.ConstLabels,
+	}, labels)
+
+	existing, err := c.register(counter)
+	if err != nil {
+		return nil, err
+	}
+
+	if v, ok := existing.(*prometheus.CounterVec); ok {
+		return v, nil
+	}
+
+	return nil, alreadyRegistered(existing, counter)
+}
+
+// NewGaugeVec returns a new prometheus.GaugeVec, registered with the Config's registerer. If an identical gauge
+// is already registered, it is returned instead.
+func (c Config) NewGaugeVec(subsystem, name, help string, labels []string) (*prometheus.GaugeVec, error) {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   c.namespace(),
+		Subsystem:   subsystem,
+		Name:        name,
+		Help:        help,
+		ConstLabels: c.ConstLabels,
+	}, labels)
+
+	existing, err := c.register(gauge)
+	if err != nil {
+		return nil, err
+	}
+
+	if v, ok := existing.(*prometheus.GaugeVec); ok {
+		return v, nil
+	}
+
+	return nil, alreadyRegistered(existing, gauge)
+}
+
+// NewHistogram returns a new prometheus.Histogram, registered with the Config's registerer. If an identical
+// histogram is already registered, it is returned instead.
+func (c Config) NewHistogram(subsystem, name, help string, buckets []float64) (prometheus.Histogram, error) {
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace:   c.namespace(),
+		Subsystem:   subsystem,
+		Name:        name,
+		Help:        help,
+		ConstLabels: c.ConstLabels,
+		Buckets:     buckets,
+	})
+
+	existing, err := c.register(histogram)
+	if err != nil {
+		return nil, err
+	}
+
+	if v, ok := existing.(prometheus.Histogram); ok {
+		return v, nil
+	}
+
+	return nil, alreadyRegistered(existing, histogram)
+}
+
+// NewHistogramVec returns a new prometheus.HistogramVec, registered with the Config's registerer. If an identical
+// histogram is already registered, it is returned instead.
+func (c Config) NewHistogramVec(subsystem, name, help string, buckets []float64, labels []string) (*prometheus.HistogramVec, error) {
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   c.namespace(),
+		Subsystem:   subsystem,
+		Name:        name,
+		Help:        help,
+		ConstLabels: c.ConstLabels,
+		Buckets:     buckets,
+	}, labels)
+
+	existing, err := c.register(histogram)
+	if err != nil {
+		return nil, err
+	}
+
+	if v, ok := existing.(*prometheus.HistogramVec); ok {
+		return v, nil
+	}
+
+	return nil, alreadyRegistered(existing, histogram)
+}
+
+func (c Config) namespace() string {
+	if c.Namespace == "" {
+		return DefaultNamespace
+	}
+
+	return c.Namespace
+}
+
+// register the collector, returning the existing collector if an identical one is already registered.
+func (c Config) register(collector prometheus.Collector) (prometheus.Collector, error) {
+	if c.Registerer == nil {
+		return collector, nil
+	}
+
+	err := c.Registerer.Register(collector)
+
+	var registered prometheus.AlreadyRegisteredError
+	switch {
+	case errors.As(err, &registered):
+		return registered.ExistingCollector, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to register metric: %w", err)
+	default:
+		return collector, nil
+	}
+}
+
+func alreadyRegistered(existing, collector prometheus.Collector) error {
+	return fmt.Errorf("failed to register metric: a %T is already registered in place of a %T", existing, collector)
+}
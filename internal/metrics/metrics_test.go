@@ -0,0 +1,81 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/kollect/internal/metrics"
+)
+
+func TestConfig_NewCounterVec(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+
+	tt := []struct {
+		Name         string
+		Config       metrics.Config
+		ExpectedName string
+		ExpectsError bool
+	}{
+		{
+			Name:         "It should not register metrics without a registerer",
+			Config:       metrics.Config{},
+			ExpectedName: "kollect_test_total",
+		},
+		{
+			Name:         "It should register metrics with the default namespace",
+			Config:       metrics.Config{Registerer: registry},
+			ExpectedName: "kollect_test_total",
+		},
+		{
+			Name:         "It should reuse metrics that are already registered",
+			Config:       metrics.Config{Registerer: registry},
+			ExpectedName: "kollect_test_total",
+		},
+		{
+			Name:         "It should register metrics with a custom namespace",
+			Config:       metrics.Config{Registerer: registry, Namespace: "custom"},
+			ExpectedName: "custom_test_total",
+		},
+		{
+			Name: "It should return an error for metrics with inconsistent labels",
+			Config: metrics.Config{
+				Registerer:  registry,
+				ConstLabels: prometheus.Labels{"consumer": "test"},
+			},
+			ExpectsError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			counter, err := tc.Config.NewCounterVec("test", "total", "Test counter", []string{"type"})
+			if tc.ExpectsError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			counter.WithLabelValues("test").Inc()
+
+			families, err := registry.Gather()
+			require.NoError(t, err)
+
+			names := make([]string, len(families))
+			for i, family := range families {
+				names[i] = family.GetName()
+			}
+
+			if tc.Config.Registerer == nil {
+				assert.Empty(t, names)
+				return
+			}
+
+			assert.Contains(t, names, tc.ExpectedName)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Package schemaregistry provides a client for registering protobuf schemas with a Confluent-compatible schema
+// registry.
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type (
+	// The Client type is used to register schemas with a schema registry.
+	Client struct {
+		baseURL  string
+		http     *http.Client
+		username string
+		password string
+	}
+
+	// The Error type describes an error returned by the schema registry.
+	Error struct {
+		StatusCode int    `json:"-"`
+		ErrorCode  int    `json:"error_code"`
+		Message    string `json:"message"`
+	}
+)
+
+const (
+	contentType = "application/vnd.schemaregistry.v1+json"
+	schemaType  = "PROTOBUF"
+)
+
+// New returns a new instance of the Client type that communicates with the schema registry at the given URL. If the
+// URL contains user information, it is used for basic authentication.
+func New(urlStr string) (*Client, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		http: http.DefaultClient,
+	}
+
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+		u.User = nil
+	}
+
+	c.baseURL = strings.TrimSuffix(u.String(), "/")
+	return c, nil
+}
+
+// Register the protobuf schema under the given subject, returning its unique identifier. If the schema is already
+// registered under the subject, the existing identifier is returned.
+func (c *Client) Register(ctx context.Context, subject, schema string) (int, error) {
+	request := struct {
+		SchemaType string `json:"schemaType"`
+		Schema     string `json:"schema"`
+	}{
+		SchemaType: schemaType,
+		Schema:     schema,
+	}
+
+	var response struct {
+		ID int `json:"id"`
+	}
+
+	endpoint := "/subjects/" + url.PathEscape(subject) + "/versions"
+	if err := c.do(ctx, http.MethodPost, endpoint, request, &response); err != nil {
+		return 0, fmt.Errorf("failed to register schema for subject %s: %w", subject, err)
+	}
+
+	return response.ID, nil
+}
+
+func (c *Client) do(ctx context.Context, method, endpoint string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", contentType)
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := &Error{StatusCode: resp.StatusCode}
+		if err = json.NewDecoder(resp.Body).Decode(e); err != nil {
+			e.Message = http.StatusText(resp.StatusCode)
+		}
+
+		return e
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Error returns a string representation of the error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("schema registry returned %d: %s", e.StatusCode, e.Message)
+}
@@ -0,0 +1,143 @@
+// Package tracing provides types/functions for configuring OpenTelemetry tracing and propagating trace context
+// within the metadata of messages written to and read from an event bus.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type (
+	// The Exporter type describes where spans are exported to.
+	Exporter string
+
+	// The Config type describes how spans are exported.
+	Config struct {
+		// Where spans are exported to. Tracing is disabled when set to ExporterNone.
+		Exporter Exporter
+		// The address of the OpenTelemetry collector spans are exported to when using ExporterOTLP. When blank, the
+		// OTEL_EXPORTER_OTLP_ENDPOINT environment variable is used, defaulting to localhost:4317.
+		Endpoint string
+		// If true, spans are exported to the OpenTelemetry collector without using TLS.
+		Insecure bool
+		// The name of the service that produced the spans.
+		ServiceName string
+		// The version of the service that produced the spans.
+		ServiceVersion string
+	}
+)
+
+// Constants for supported exporters.
+const (
+	ExporterNone   = Exporter("none")
+	ExporterStdout = Exporter("stdout")
+	ExporterOTLP   = Exporter("otlp")
+)
+
+// The name of the instrumentation library used for all spans.
+const instrumentationName = "github.com/davidsbond/kollect"
+
+// Trace context is always propagated using the W3C trace context format, regardless of the global propagator, so
+// that producers and consumers agree on the metadata keys used.
+var propagator = propagation.TraceContext{}
+
+// NewTracerProvider returns a trace.TracerProvider that exports spans as described by the Config, and a function
+// that flushes any remaining spans and stops exporting them. When the Config's Exporter is ExporterNone, a
+// trace.TracerProvider that records nothing is returned.
+func NewTracerProvider(ctx context.Context, config Config) (trace.TracerProvider, func(context.Context) error, error) {
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+
+	switch config.Exporter {
+	case ExporterNone, "":
+		return trace.NewNoopTracerProvider(), func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New()
+	case ExporterOTLP:
+		var opts []otlptracegrpc.Option
+		if config.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(config.Endpoint))
+		}
+		if config.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	default:
+		return nil, nil, fmt.Errorf("unsupported tracing exporter %q", config.Exporter)
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create %s exporter: %w", config.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(config.ServiceName),
+		semconv.ServiceVersionKey.String(config.ServiceVersion),
+	))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	return provider, provider.Shutdown, nil
+}
+
+// Tracer returns the trace.Tracer used to create spans from the given provider. When the provider is nil, the global
+// trace.TracerProvider is used.
+func Tracer(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+
+	return provider.Tracer(instrumentationName)
+}
+
+// Inject the trace context of the span within ctx into the message metadata using the W3C traceparent and
+// tracestate keys, returning the resulting metadata. The metadata is returned unmodified if ctx does not contain a
+// span being recorded, so that messages are unchanged while tracing is disabled.
+func Inject(ctx context.Context, metadata map[string]string) map[string]string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return metadata
+	}
+
+	if metadata == nil {
+		metadata = make(map[string]string, len(carrier))
+	}
+
+	for k, v := range carrier {
+		metadata[k] = v
+	}
+
+	return metadata
+}
+
+// Extract the trace context from the message metadata, returning a context.Context whose remote span is the span
+// that wrote the message. The context is returned unmodified if the metadata contains no trace context.
+func Extract(ctx context.Context, metadata map[string]string) context.Context {
+	return propagator.Extract(ctx, propagation.MapCarrier(metadata))
+}
+
+// Fail records the error against the span and marks it as failed.
+func Fail(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
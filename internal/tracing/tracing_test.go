@@ -0,0 +1,71 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/davidsbond/kollect/internal/tracing"
+)
+
+func TestInject(t *testing.T) {
+	t.Parallel()
+
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "test")
+	defer span.End()
+
+	tt := []struct {
+		Name        string
+		Context     context.Context
+		Metadata    map[string]string
+		Expected    map[string]string
+		ExpectsSpan bool
+	}{
+		{
+			Name:    "It should not modify metadata without a span",
+			Context: context.Background(),
+		},
+		{
+			Name:     "It should not modify existing metadata without a span",
+			Context:  context.Background(),
+			Metadata: map[string]string{"content-type": "application/json"},
+			Expected: map[string]string{"content-type": "application/json"},
+		},
+		{
+			Name:        "It should add the traceparent to metadata",
+			Context:     ctx,
+			ExpectsSpan: true,
+		},
+		{
+			Name:        "It should add the traceparent to existing metadata",
+			Context:     ctx,
+			Metadata:    map[string]string{"content-type": "application/json"},
+			Expected:    map[string]string{"content-type": "application/json"},
+			ExpectsSpan: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual := tracing.Inject(tc.Context, tc.Metadata)
+			if !tc.ExpectsSpan {
+				assert.Equal(t, tc.Expected, actual)
+				return
+			}
+
+			assert.Contains(t, actual, "traceparent")
+			for k, v := range tc.Expected {
+				assert.Equal(t, v, actual[k])
+			}
+
+			extracted := trace.SpanContextFromContext(tracing.Extract(context.Background(), actual))
+			assert.True(t, extracted.IsRemote())
+			assert.Equal(t, span.SpanContext().TraceID(), extracted.TraceID())
+			assert.Equal(t, span.SpanContext().SpanID(), extracted.SpanID())
+		})
+	}
+}
@@ -4,6 +4,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,7 +12,9 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
@@ -19,33 +22,134 @@ import (
 	"k8s.io/client-go/dynamic"
 	"k8s.io/klog/v2"
 
+	"github.com/davidsbond/kollect/internal/admin"
 	"github.com/davidsbond/kollect/internal/agent"
 	"github.com/davidsbond/kollect/internal/event"
 	"github.com/davidsbond/kollect/internal/kubernetes"
+	"github.com/davidsbond/kollect/internal/logging"
+	"github.com/davidsbond/kollect/internal/metrics"
+	"github.com/davidsbond/kollect/internal/tracing"
 )
 
 var version string
 
 func main() {
 	var (
-		eventWriterURL string
-		kubeConfig     string
-		namespace      string
-		waitForSync    bool
-		clusterID      string
+		eventWriterURLs []string
+		eventDelivery   string
+		kubeConfig      string
+		namespace       string
+		waitForSync     bool
+		clusterID       string
+
+		claimCheckURL       string
+		claimCheckThreshold int
+
+		eventEncoding   string
+		eventDataFormat string
+
+		schemaRegistryURL string
+		eventRoutesFile   string
+
+		metricsNamespaceLabel bool
+		legacyMetrics         bool
+
+		tracingExporter string
+		tracingEndpoint string
+		tracingInsecure bool
+
+		healthFailureThreshold time.Duration
+
+		kubernetesEventsObject    string
+		kubernetesEventsNamespace string
+
+		adminConfig admin.Config
+
+		logFormat             string
+		logVerbosity          int
+		logComponentVerbosity map[string]int
 	)
 
 	closer := func(c io.Closer) {
 		if err := c.Close(); err != nil {
-			klog.Errorf("failed to close %T: %v\n", c, err)
+			klog.ErrorS(err, "Failed to close", "type", fmt.Sprintf("%T", c))
 		}
 	}
 
 	run := func(ctx context.Context) error {
-		eventWriter, err := event.NewWriter(ctx, eventWriterURL)
+		metricsConfig := metrics.Config{
+			Registerer:     prometheus.DefaultRegisterer,
+			NamespaceLabel: metricsNamespaceLabel,
+			Legacy:         legacyMetrics,
+		}
+
+		tracerProvider, shutdownTracing, err := tracing.NewTracerProvider(ctx, tracing.Config{
+			Exporter:       tracing.Exporter(tracingExporter),
+			Endpoint:       tracingEndpoint,
+			Insecure:       tracingInsecure,
+			ServiceName:    "kollect",
+			ServiceVersion: version,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to configure tracing: %w", err)
+		}
+		defer func() {
+			// The context may already be cancelled, so remaining spans are flushed using a new one.
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+			defer cancel()
+
+			if err := shutdownTracing(ctx); err != nil {
+				klog.ErrorS(err, "Failed to flush spans")
+			}
+		}()
+
+		writerOpts := []event.WriterOption{
+			event.WithEncoding(event.Encoding(eventEncoding)),
+			event.WithDataFormat(event.DataFormat(eventDataFormat)),
+			event.WithWriterMetrics(metricsConfig),
+			event.WithWriterTracerProvider(tracerProvider),
+		}
+
+		if schemaRegistryURL != "" {
+			writerOpts = append(writerOpts, event.WithSchemaRegistry(schemaRegistryURL))
+		}
+
+		if claimCheckURL != "" {
+			writerOpts = append(writerOpts, event.WithClaimCheck(claimCheckURL, claimCheckThreshold))
+		}
+
+		var routes []event.Route
+		if eventRoutesFile != "" {
+			routes, err = event.LoadRoutes(eventRoutesFile)
+			if err != nil {
+				return fmt.Errorf("failed to load event routes: %w", err)
+			}
+		}
+
+		var (
+			writer event.WriteCloser
+			sinks  agent.SinkStatuser
+		)
+
+		if len(eventWriterURLs) == 1 {
+			writer, err = event.NewWriter(ctx, eventWriterURLs[0], writerOpts...)
+		} else {
+			var multi *event.MultiWriter
+			multi, err = event.NewMultiWriter(ctx, eventWriterURLs, event.Delivery(eventDelivery), writerOpts...)
+			writer, sinks = multi, multi
+		}
 		if err != nil {
 			return fmt.Errorf("failed to connect to event bus: %w", err)
 		}
+
+		eventWriter := writer
+		if len(routes) > 0 {
+			eventWriter, err = event.NewRouter(writer, routes, writerOpts...)
+			if err != nil {
+				closer(writer)
+				return fmt.Errorf("failed to create event router: %w", err)
+			}
+		}
 		defer closer(eventWriter)
 
 		k8sConfig, err := kubernetes.Config(kubeConfig)
@@ -55,9 +159,13 @@ func main() {
 
 		cnf := agent.Config{
 			EventWriter:      eventWriter,
+			Sinks:            sinks,
 			Namespace:        namespace,
 			WaitForCacheSync: waitForSync,
 			ClusterID:        clusterID,
+			Metrics:          metricsConfig,
+			TracerProvider:   tracerProvider,
+			FailureThreshold: healthFailureThreshold,
 		}
 
 		cnf.Resources, err = kubernetes.GetResourcesWithVerbs(k8sConfig, []string{"get", "list", "watch"})
@@ -70,55 +178,132 @@ func main() {
 			return fmt.Errorf("failed to create dynamic k8s client: %w", err)
 		}
 
-		ag := agent.New(cnf)
+		if kubernetesEventsObject != "" {
+			cnf.EventObject, err = kubernetes.ObjectReference(ctx, k8sConfig, kubernetesEventsNamespace, kubernetesEventsObject)
+			if err != nil {
+				return fmt.Errorf("failed to find object to record k8s events for: %w", err)
+			}
+
+			var stopRecording func()
+			cnf.EventRecorder, stopRecording, err = kubernetes.EventRecorder(k8sConfig, "kollect")
+			if err != nil {
+				return fmt.Errorf("failed to create k8s event recorder: %w", err)
+			}
+			defer stopRecording()
+		}
+
+		ag, err := agent.New(cnf)
+		if err != nil {
+			return fmt.Errorf("failed to create agent: %w", err)
+		}
+
+		svr, err := admin.New(adminConfig)
+		if err != nil {
+			return fmt.Errorf("failed to create admin server: %w", err)
+		}
+
+		svr.Handle("/__/metrics", promhttp.Handler())
+		svr.HandleProtected("/__/pprof/profile", http.HandlerFunc(pprof.Profile))
+		svr.HandleProtected("/__/pprof/trace", http.HandlerFunc(pprof.Trace))
+		svr.HandleProtected("/__/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+		svr.HandleProtected("/__/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+
+		svr.HandleProbe("/__/ready", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !ag.Ready() {
+				w.WriteHeader(http.StatusPreconditionFailed)
+			}
+		}))
+
+		svr.HandleProbe("/__/health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := ag.Healthy(); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			}
+		}))
+
+		svr.HandleProtected("/__/status", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(ag.Status()); err != nil {
+				klog.FromContext(ctx).Error(err, "Failed to write status")
+			}
+		}))
+
 		grp, ctx := errgroup.WithContext(ctx)
 		grp.Go(func() error {
 			return ag.Run(ctx)
 		})
 
+		klog.FromContext(ctx).Info("Serving admin endpoints", "address", svr.Addr().String(), "probeAddress", svr.ProbeAddr().String())
 		grp.Go(func() error {
-			mux := http.NewServeMux()
-			svr := &http.Server{Addr: ":8081", Handler: mux}
-
-			mux.Handle("/__/metrics", promhttp.Handler())
-			mux.HandleFunc("/__/pprof/profile", pprof.Profile)
-			mux.HandleFunc("/__/pprof/trace", pprof.Trace)
-			mux.HandleFunc("/__/pprof/cmdline", pprof.Cmdline)
-			mux.HandleFunc("/__/pprof/symbol", pprof.Symbol)
-
-			mux.HandleFunc("/__/ready", func(w http.ResponseWriter, r *http.Request) {
-				if !ag.Ready() {
-					w.WriteHeader(http.StatusPreconditionFailed)
-				}
-			})
-
-			mux.HandleFunc("/__/health", func(w http.ResponseWriter, r *http.Request) {})
-
-			return svr.ListenAndServe()
+			return svr.Serve(ctx)
 		})
 
 		return grp.Wait()
 	}
 
+	// withLogging returns a function that configures logging before invoking run, exiting if run returns an error.
+	withLogging := func(run func(ctx context.Context) error, failure string) func(cmd *cobra.Command, args []string) {
+		return func(cmd *cobra.Command, args []string) {
+			logger, flush, err := logging.New(logging.Config{
+				Format:     logging.Format(logFormat),
+				Verbosity:  logVerbosity,
+				Components: logComponentVerbosity,
+			}, os.Stderr)
+			if err != nil {
+				klog.Exitln(err)
+			}
+			defer flush()
+
+			ctx := klog.NewContext(cmd.Context(), logger)
+			if err = run(ctx); err != nil {
+				logger.Error(err, failure)
+				flush()
+				os.Exit(1)
+			}
+		}
+	}
+
 	cmd := &cobra.Command{
 		Use:     "kollect",
 		Short:   "Publish changes in your Kubernetes resources as events on your choice of event bus",
 		Version: version,
-		Run: func(cmd *cobra.Command, args []string) {
-			ctx := cmd.Context()
-
-			if err := run(ctx); err != nil {
-				klog.Exitln(err)
-			}
-		},
+		Run:     withLogging(run, "Agent stopped"),
 	}
 
-	flags := cmd.PersistentFlags()
+	cmd.AddCommand(consumeCommand(withLogging))
+
+	flags := cmd.Flags()
 	flags.StringVar(&namespace, "namespace", v1.NamespaceAll, "Specifies the namespace that the agent will monitor resources in, defaults to all")
-	flags.StringVar(&eventWriterURL, "event-writer-url", "", "URL of the event bus to send resource events to, see documentation for possible values")
+	flags.StringArrayVar(&eventWriterURLs, "event-writer-url", nil, "URL of the event bus to send resource events to, see documentation for possible values. Can be specified multiple times to send events to multiple event buses")
+	flags.StringVar(&eventDelivery, "event-delivery", string(event.DeliveryAll), "When using multiple event writer URLs, determines if events must be written to all event buses (all) or at least one (best-effort)")
 	flags.StringVar(&kubeConfig, "kube-config", "", "Location of the kubeconfig file to use for authentication. In-cluster config used if blank")
 	flags.BoolVar(&waitForSync, "wait-for-sync", false, "If set, no events will be published until the caches are synced. When false, events will be published for the entire cluster state on start")
 	flags.StringVar(&clusterID, "cluster-id", "", "The unique identifier for the cluster the agent is running in")
+	flags.StringVar(&eventEncoding, "event-encoding", string(event.EncodingProto), "The encoding used for published events, one of proto, json, cloudevents-structured or cloudevents-binary. Can also be set using the encoding query parameter of --event-writer-url")
+	flags.StringVar(&eventDataFormat, "event-data-format", string(event.DataFormatJSON), "The format of event payloads when using a CloudEvents encoding, one of json or proto")
+	flags.StringVar(&eventRoutesFile, "event-routes", "", "Location of a file describing routes that write specific events to other event buses, see documentation for the file format")
+	flags.StringVar(&schemaRegistryURL, "schema-registry-url", "", "URL of a Confluent-compatible schema registry to register event schemas with, only supported for Apache Kafka")
+	flags.StringVar(&claimCheckURL, "claim-check-url", "", "URL of the blob storage bucket to write events that exceed the claim check threshold to, see documentation for possible values")
+	flags.IntVar(&claimCheckThreshold, "claim-check-threshold", event.DefaultClaimCheckThreshold, "The size in bytes above which events are written to blob storage rather than the event bus, requires --claim-check-url")
+	flags.BoolVar(&metricsNamespaceLabel, "metrics-namespace-label", false, "If set, event metrics are labelled by the namespace of the resource")
+	flags.BoolVar(&legacyMetrics, "legacy-metrics", false, "If set, the deprecated event metrics labelled by event key are also recorded")
+	flags.StringVar(&tracingExporter, "tracing-exporter", string(tracing.ExporterNone), "Where OpenTelemetry spans are exported to, one of none, stdout or otlp")
+	flags.StringVar(&tracingEndpoint, "tracing-endpoint", "", "Address of the OpenTelemetry collector spans are exported to when using the otlp exporter, defaults to the OTEL_EXPORTER_OTLP_ENDPOINT environment variable")
+	flags.BoolVar(&tracingInsecure, "tracing-insecure", false, "If set, spans are exported to the OpenTelemetry collector without using TLS")
+	flags.StringVar(&adminConfig.Address, "admin-address", admin.DefaultAddress, "The address metrics, profiling, status and probe endpoints are served on")
+	flags.StringVar(&adminConfig.ProbeAddress, "admin-probe-address", "", "If set, the address readiness and health probes are served on instead of --admin-address. Probes served on a separate address do not use TLS")
+	flags.StringVar(&adminConfig.TLSCertFile, "admin-tls-cert-file", "", "Location of the certificate used to serve admin endpoints using TLS, reloaded when modified")
+	flags.StringVar(&adminConfig.TLSKeyFile, "admin-tls-key-file", "", "Location of the private key used to serve admin endpoints using TLS, reloaded when modified")
+	flags.StringVar(&adminConfig.ClientCAFile, "admin-client-ca-file", "", "Location of the certificate authorities used to verify client certificates. If set, profiling and status endpoints can be accessed using a verified client certificate")
+	flags.StringVar(&adminConfig.BearerTokenFile, "admin-bearer-token-file", "", "Location of a file containing a bearer token. If set, profiling and status endpoints can be accessed using the token")
+	flags.DurationVar(&adminConfig.ShutdownTimeout, "admin-shutdown-timeout", time.Second*10, "How long to wait for in-flight requests to admin endpoints to complete when shutting down")
+	flags.DurationVar(&healthFailureThreshold, "health-failure-threshold", time.Minute*5, "How long events must continuously fail to be published before the agent is considered unhealthy, disabled when zero")
+	flags.StringVar(&kubernetesEventsObject, "kubernetes-events-object", defaultKubernetesEventsObject(), "The object to record k8s events describing problems with the agent against, in the form <resource>/<name>. Defaults to the agent's pod when the POD_NAME environment variable is set, disabled when blank")
+	flags.StringVar(&kubernetesEventsNamespace, "kubernetes-events-namespace", os.Getenv("POD_NAMESPACE"), "The namespace of the object k8s events are recorded against. Defaults to the POD_NAMESPACE environment variable")
+
+	flags = cmd.PersistentFlags()
+	flags.StringVar(&logFormat, "log-format", string(logging.FormatText), "The format logs are written in, one of text or json")
+	flags.IntVar(&logVerbosity, "log-verbosity", 0, "The verbosity of logs, greater values include more detailed logs")
+	flags.StringToIntVar(&logComponentVerbosity, "log-component-verbosity", nil, "The verbosity of logs written by individual components, overriding --log-verbosity. For example, agent=4,event=2")
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
@@ -127,3 +312,14 @@ func main() {
 		klog.Exitln(err)
 	}
 }
+
+// defaultKubernetesEventsObject returns the agent's own pod, as described by the POD_NAME environment variable, so
+// that k8s events are recorded against it.
+func defaultKubernetesEventsObject() string {
+	name := os.Getenv("POD_NAME")
+	if name == "" {
+		return ""
+	}
+
+	return "pods/" + name
+}
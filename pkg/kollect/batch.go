@@ -0,0 +1,323 @@
+package kollect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/davidsbond/kollect/internal/event"
+	"github.com/davidsbond/kollect/internal/tracing"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+type (
+	// The Event type describes a single resource event within a batch.
+	Event struct {
+		// The metadata of the event, use Metadata.Type to determine the kind of change.
+		Metadata Metadata
+		// The cluster the resource belongs to.
+		ClusterID string
+		// The unique identifier of the resource.
+		ResourceUID string
+		// The resource before it was modified, only set for updated events.
+		Then *unstructured.Unstructured
+		// The resource after it was created or modified, not set for deleted events.
+		Now *unstructured.Unstructured
+	}
+
+	// The BatchHandler type is a function that is invoked with a batch of events by HandleBatch. Events are given in
+	// the order they were received. Returning a *BatchError indicates that only some of the events in the batch
+	// failed, returning any other error indicates that the whole batch failed.
+	BatchHandler func(ctx context.Context, events []Event) error
+
+	// The BatchError type is an error returned by a BatchHandler when only some of the events in a batch could not
+	// be handled. Errors are keyed by the index of the event within the batch.
+	BatchError = event.BatchError
+
+	// The batchGuard type tracks the deduplication keys and resource versions of the events within a batch, so that
+	// duplicate and stale events are detected against earlier events in the same batch as well as those already
+	// handled. Keys and versions are keyed by the index of the event within the batch.
+	batchGuard struct {
+		seen     map[string]bool
+		latest   map[string]appliedVersion
+		keys     map[int][]string
+		versions map[int]resourceKeyVersion
+	}
+
+	resourceKeyVersion struct {
+		key     string
+		version appliedVersion
+	}
+)
+
+// HandleBatch handles inbound events in batches of up to size events, invoking fn for each batch. A batch is handed
+// to fn once it contains size events, or once wait has elapsed since its first event was received, whichever comes
+// first. Batches are handled one at a time.
+//
+// Events in a batch are acknowledged once fn returns nil. If fn returns a *BatchError, the events it does not
+// contain are acknowledged and only the failed events are retried. Any other error fails the whole batch. See
+// WithRetry, WithDeadLetterURL, WithDeadLetterHandler and WithContinueOnError for changing how failed events are
+// handled.
+//
+// Filters set using options such as WithNamespaces, along with WithDeduplication and WithStaleProtection, are applied
+// to each event before it is added to a batch. Stale events are given to handlers registered using OnStaleEvent, and
+// are not included in the batch. Handlers registered using OnResourceCreated and similar methods are not used. Returns
+// an error if middleware has been added using WithMiddleware, as middleware wraps the handling of individual events.
+// This method blocks until the provided context is cancelled or a batch could not be handled.
+func (eh *EventHandler) HandleBatch(ctx context.Context, size int, wait time.Duration, fn BatchHandler) error {
+	var err error
+	if len(eh.middleware) > 0 {
+		err = errors.New("middleware is not supported when handling batches")
+	} else {
+		err = eh.reader.ReadBatch(eh.contextWithLogger(ctx), size, wait, func(ctx context.Context, evts []event.Event) error {
+			return eh.handleBatch(ctx, evts, fn)
+		})
+	}
+
+	if closeErr := eh.reader.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// handleBatch converts the batch into Event types, omitting those that do not match the filter and those that are
+// duplicate or stale, and invokes fn. Any errors returned by fn are mapped back to the indexes of the original batch.
+func (eh *EventHandler) handleBatch(ctx context.Context, evts []event.Event, fn BatchHandler) error {
+	var (
+		events  = make([]Event, 0, len(evts))
+		indexes = make([]int, 0, len(evts))
+		failed  = make(map[int]error)
+		guard   = newBatchGuard()
+	)
+
+	for i, evt := range evts {
+		if eh.eventFilter != nil {
+			ok, err := eh.eventFilter.matches(evt)
+			if err != nil {
+				failed[i] = err
+				continue
+			}
+
+			if !ok {
+				eh.metrics.filtered(evt)
+				continue
+			}
+		}
+
+		e, ok, err := newEvent(evt)
+		if err != nil {
+			failed[i] = err
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		skip, err := eh.guardBatch(ctx, guard, i, evt)
+		switch {
+		case err != nil:
+			failed[i] = err
+		case !skip:
+			events = append(events, e)
+			indexes = append(indexes, i)
+		}
+	}
+
+	var err error
+	if len(events) > 0 {
+		err = eh.invokeBatch(ctx, events, fn)
+	}
+
+	var batchErr *BatchError
+	switch {
+	case errors.As(err, &batchErr):
+		for i, e := range batchErr.Errors {
+			if i >= 0 && i < len(indexes) && e != nil {
+				failed[indexes[i]] = e
+			}
+		}
+	case err != nil && len(failed) == 0:
+		for _, e := range events {
+			eh.metrics.handlerErrors.WithLabelValues(e.Metadata.Type).Inc()
+		}
+
+		return err
+	case err != nil:
+		for _, i := range indexes {
+			failed[i] = err
+		}
+	}
+
+	for _, i := range indexes {
+		if _, ok := failed[i]; !ok {
+			if err = eh.recordBatch(ctx, guard, i); err != nil {
+				failed[i] = err
+			}
+		}
+	}
+
+	for i, evt := range evts {
+		if _, ok := failed[i]; !ok {
+			eh.metrics.observeLatency(evt)
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	for i := range failed {
+		eh.metrics.handlerErrors.WithLabelValues(evts[i].Type()).Inc()
+	}
+
+	return &BatchError{Errors: failed}
+}
+
+func newBatchGuard() *batchGuard {
+	return &batchGuard{
+		seen:     make(map[string]bool),
+		latest:   make(map[string]appliedVersion),
+		keys:     make(map[int][]string),
+		versions: make(map[int]resourceKeyVersion),
+	}
+}
+
+// guardBatch returns true if the event at index i of the batch should be omitted from it because it is a duplicate
+// or is stale, when using WithDeduplication or WithStaleProtection. Stale events are given to handlers registered using
+// OnStaleEvent.
+func (eh *EventHandler) guardBatch(ctx context.Context, guard *batchGuard, i int, evt event.Event) (bool, error) {
+	var keys []string
+	if eh.deduplicator != nil {
+		var (
+			seen bool
+			err  error
+		)
+
+		keys, seen, err = eh.deduplicator.seen(ctx, evt)
+		if err != nil {
+			return false, err
+		}
+
+		for _, key := range keys {
+			seen = seen || guard.seen[key]
+		}
+
+		if seen {
+			eh.metrics.duplicatesSkipped.WithLabelValues(evt.Type()).Inc()
+			return true, nil
+		}
+	}
+
+	if eh.staleGuard != nil {
+		key, version, stale, err := eh.staleGuard.check(evt)
+		if err != nil {
+			return false, err
+		}
+
+		if latest, ok := guard.latest[key]; ok && version.olderThan(latest) {
+			stale = true
+		}
+
+		if stale {
+			eh.metrics.staleEvents.WithLabelValues(evt.Type()).Inc()
+			return true, eh.handleStaleEvent(ctx, evt)
+		}
+
+		if key != "" {
+			guard.latest[key] = version
+			guard.versions[i] = resourceKeyVersion{key: key, version: version}
+		}
+	}
+
+	for _, key := range keys {
+		guard.seen[key] = true
+	}
+
+	guard.keys[i] = keys
+	return false, nil
+}
+
+// recordBatch records the deduplication keys and resource version of the event at index i of the batch once it has
+// been handled successfully.
+func (eh *EventHandler) recordBatch(ctx context.Context, guard *batchGuard, i int) error {
+	if eh.deduplicator != nil {
+		if err := eh.deduplicator.markSeen(ctx, guard.keys[i]); err != nil {
+			return err
+		}
+	}
+
+	if v, ok := guard.versions[i]; ok {
+		eh.staleGuard.record(v.key, v.version)
+	}
+
+	return nil
+}
+
+// invokeBatch invokes fn with the events within a span, recording the duration of the batch and the number of
+// in-flight events.
+func (eh *EventHandler) invokeBatch(ctx context.Context, events []Event, fn BatchHandler) error {
+	start := time.Now()
+
+	ctx, span := eh.tracer.Start(ctx, "handle batch", trace.WithAttributes(
+		attribute.Int("kollect.batch.size", len(events)),
+	))
+	defer span.End()
+	for _, e := range events {
+		eh.metrics.inFlight.WithLabelValues(e.Metadata.Type).Inc()
+	}
+
+	defer func() {
+		for _, e := range events {
+			eh.metrics.inFlight.WithLabelValues(e.Metadata.Type).Dec()
+		}
+	}()
+
+	err := fn(ctx, events)
+	eh.metrics.batchDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		tracing.Fail(span, err)
+	}
+
+	return err
+}
+
+// newEvent converts a resource event into the Event type. Returns false if the event does not describe a change to
+// a resource.
+func newEvent(evt event.Event) (Event, bool, error) {
+	e := Event{
+		Metadata: newMetadata(evt),
+	}
+
+	switch payload := evt.Payload.(type) {
+	case *resource.ResourceCreatedEvent:
+		e.ClusterID, e.ResourceUID = payload.GetClusterId(), payload.GetUid()
+		e.Now = &unstructured.Unstructured{}
+		if err := json.Unmarshal(payload.GetResource(), e.Now); err != nil {
+			return e, false, fmt.Errorf("failed to unmarshal resource %s: %w", payload.GetUid(), err)
+		}
+	case *resource.ResourceUpdatedEvent:
+		e.ClusterID, e.ResourceUID = payload.GetClusterId(), payload.GetUid()
+		e.Then, e.Now = &unstructured.Unstructured{}, &unstructured.Unstructured{}
+		if err := json.Unmarshal(payload.GetThen(), e.Then); err != nil {
+			return e, false, fmt.Errorf("failed to unmarshal resource %s: %w", payload.GetUid(), err)
+		}
+
+		if err := json.Unmarshal(payload.GetNow(), e.Now); err != nil {
+			return e, false, fmt.Errorf("failed to unmarshal resource %s: %w", payload.GetUid(), err)
+		}
+	case *resource.ResourceDeletedEvent:
+		e.ClusterID, e.ResourceUID = payload.GetClusterId(), payload.GetUid()
+	default:
+		return e, false, nil
+	}
+
+	return e, true, nil
+}
@@ -0,0 +1,203 @@
+package kollect_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/kollect/internal/event"
+	"github.com/davidsbond/kollect/pkg/kollect"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+func TestEventHandler_HandleBatch(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	writer, err := event.NewWriter(ctx, "mem://batch")
+	require.NoError(t, err)
+	defer writer.Close()
+
+	registry := prometheus.NewRegistry()
+	handler, err := kollect.NewEventHandler(ctx, "mem://batch",
+		kollect.WithRegisterer(registry),
+		kollect.WithNamespaces("default"),
+		kollect.WithRetry(2, time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	events := []event.Event{
+		event.New(&resource.ResourceCreatedEvent{
+			Uid:       "created",
+			Resource:  mustMarshal(t, object("v1", "Pod", "default", "created", nil)),
+			ClusterId: "test",
+		}),
+		event.New(&resource.ResourceUpdatedEvent{
+			Uid:       "updated",
+			Then:      mustMarshal(t, object("v1", "Pod", "default", "updated", nil)),
+			Now:       mustMarshal(t, object("v1", "Pod", "default", "updated", nil)),
+			ClusterId: "test",
+		}),
+		// Events that do not match the filter should not be included in a batch.
+		event.New(&resource.ResourceCreatedEvent{
+			Uid:       "filtered",
+			Resource:  mustMarshal(t, object("v1", "Pod", "other", "filtered", nil)),
+			ClusterId: "test",
+		}),
+		event.New(&resource.ResourceDeletedEvent{
+			Uid:       "deleted",
+			ClusterId: "test",
+		}),
+	}
+
+	for _, evt := range events {
+		require.NoError(t, writer.Write(ctx, evt))
+	}
+
+	var (
+		attempts = make(map[string]int)
+		handled  = make(map[string]kollect.Event)
+	)
+
+	err = handler.HandleBatch(ctx, 10, time.Millisecond*100, func(ctx context.Context, batch []kollect.Event) error {
+		batchErr := &kollect.BatchError{Errors: make(map[int]error)}
+		for i, evt := range batch {
+			attempts[evt.ResourceUID]++
+
+			// The updated event fails on its first attempt, so should be retried on its own.
+			if evt.ResourceUID == "updated" && attempts[evt.ResourceUID] == 1 {
+				batchErr.Errors[i] = errors.New("failed")
+				continue
+			}
+
+			handled[evt.ResourceUID] = evt
+		}
+
+		if len(handled) == 3 {
+			cancel()
+		}
+
+		return batchErr
+	})
+
+	require.NoError(t, err)
+	require.Len(t, handled, 3)
+	assert.NotContains(t, handled, "filtered")
+	assert.Equal(t, 2, attempts["updated"])
+	assert.Equal(t, 1, attempts["created"])
+	assert.Equal(t, 1, attempts["deleted"])
+
+	assert.Equal(t, kollect.EventTypeCreated, handled["created"].Metadata.Type)
+	assert.Nil(t, handled["created"].Then)
+	assert.Equal(t, "created", handled["created"].Now.GetName())
+
+	assert.Equal(t, kollect.EventTypeUpdated, handled["updated"].Metadata.Type)
+	assert.Equal(t, "updated", handled["updated"].Then.GetName())
+	assert.Equal(t, "updated", handled["updated"].Now.GetName())
+
+	assert.Equal(t, kollect.EventTypeDeleted, handled["deleted"].Metadata.Type)
+	assert.Equal(t, "test", handled["deleted"].ClusterID)
+	assert.Nil(t, handled["deleted"].Now)
+
+	// Batches are timed separately from the handlers of individual event types.
+	assert.EqualValues(t, 2, gatherHistogram(t, registry, "kollect_consumer_batch_duration_seconds"))
+	assert.Zero(t, gather(t, registry, "kollect_consumer_handler_duration_seconds", "batch"))
+}
+
+func TestEventHandler_HandleBatchDuplicateAndStale(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Events are delivered in the order they are written, so that stale events are detected deterministically.
+	writer, err := event.NewWriter(ctx, "ordered://batch-guards")
+	require.NoError(t, err)
+	defer writer.Close()
+
+	handler, err := kollect.NewEventHandler(ctx, "ordered://batch-guards",
+		kollect.WithDeduplication(kollect.NewMemoryDeduplicationStore(10, time.Minute)),
+		kollect.WithStaleProtection(10, time.Minute),
+	)
+	require.NoError(t, err)
+
+	stale := 0
+	handler.OnStaleEvent(func(ctx context.Context, clusterID, resourceUID string) error {
+		stale++
+		return nil
+	})
+
+	now := time.Now()
+	first := updated(t, "2", now)
+
+	// Duplicate and stale events should be detected against earlier events within the same batch.
+	for _, evt := range []event.Event{first, first, updated(t, "1", now)} {
+		require.NoError(t, writer.Write(ctx, evt))
+	}
+
+	batches := make([][]kollect.Event, 0)
+	err = handler.HandleBatch(ctx, 10, time.Millisecond*100, func(ctx context.Context, batch []kollect.Event) error {
+		batches = append(batches, batch)
+		if len(batches) == 2 {
+			cancel()
+			return nil
+		}
+
+		// Once handled, duplicate and stale events should be detected against those in previous batches.
+		for _, evt := range []event.Event{first, updated(t, "1", now), deleted(now)} {
+			assert.NoError(t, writer.Write(ctx, evt))
+		}
+
+		return nil
+	})
+
+	require.NoError(t, err)
+	require.Len(t, batches, 2)
+
+	require.Len(t, batches[0], 1)
+	assert.Equal(t, kollect.EventTypeUpdated, batches[0][0].Metadata.Type)
+	assert.Equal(t, "2", batches[0][0].Now.GetResourceVersion())
+
+	require.Len(t, batches[1], 1)
+	assert.Equal(t, kollect.EventTypeDeleted, batches[1][0].Metadata.Type)
+	assert.Equal(t, 2, stale)
+}
+
+func TestEventHandler_HandleBatchMiddleware(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	handler, err := kollect.NewEventHandler(ctx, "ordered://batch-middleware", kollect.WithMiddleware(kollect.Recover()))
+	require.NoError(t, err)
+
+	err = handler.HandleBatch(ctx, 10, time.Millisecond*100, func(ctx context.Context, batch []kollect.Event) error {
+		return nil
+	})
+
+	assert.EqualError(t, err, "middleware is not supported when handling batches")
+}
+
+// gatherHistogram returns the sample count of an unlabelled histogram with the given name from the registry.
+func gatherHistogram(t *testing.T, registry *prometheus.Registry, name string) uint64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) > 0 {
+			return family.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+
+	return 0
+}
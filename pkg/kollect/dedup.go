@@ -0,0 +1,204 @@
+package kollect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/cache"
+
+	"github.com/davidsbond/kollect/internal/event"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+type (
+	// The DeduplicationStore interface describes types that record which events have been handled, so that
+	// duplicate events can be skipped. Implementations must be safe for concurrent use.
+	DeduplicationStore interface {
+		// Seen returns true if the key has been marked as seen.
+		Seen(ctx context.Context, key string) (bool, error)
+		// MarkSeen records that the key has been seen.
+		MarkSeen(ctx context.Context, key string) error
+	}
+
+	// The DeduplicationKey type describes how duplicate events are identified.
+	DeduplicationKey string
+
+	// The MemoryDeduplicationStore type is a DeduplicationStore implementation that stores keys in memory. Once full,
+	// the least recently used keys are evicted.
+	MemoryDeduplicationStore struct {
+		cache *cache.LRUExpireCache
+		ttl   time.Duration
+	}
+
+	deduplicator struct {
+		store DeduplicationStore
+		keys  []DeduplicationKey
+	}
+)
+
+// Supported values for the DeduplicationKey type.
+const (
+	// DeduplicateByEventID identifies duplicate events using their unique identifier. This detects events that have
+	// been redelivered by the event bus.
+	DeduplicateByEventID DeduplicationKey = "event-id"
+	// DeduplicateByResourceVersion identifies duplicate events using the cluster, UID and resource version of the
+	// resource they describe. This detects events that have been published more than once, such as when the agent
+	// restarts and publishes the entire state of the cluster.
+	DeduplicateByResourceVersion DeduplicationKey = "resource-version"
+)
+
+// NewMemoryDeduplicationStore returns a new instance of the MemoryDeduplicationStore type that stores up to size keys,
+// each of which is forgotten once the ttl has elapsed.
+func NewMemoryDeduplicationStore(size int, ttl time.Duration) *MemoryDeduplicationStore {
+	return &MemoryDeduplicationStore{
+		cache: cache.NewLRUExpireCache(size),
+		ttl:   ttl,
+	}
+}
+
+// Seen returns true if the key has been marked as seen and has not expired.
+func (m *MemoryDeduplicationStore) Seen(_ context.Context, key string) (bool, error) {
+	_, ok := m.cache.Get(key)
+	return ok, nil
+}
+
+// MarkSeen records that the key has been seen.
+func (m *MemoryDeduplicationStore) MarkSeen(_ context.Context, key string) error {
+	m.cache.Add(key, struct{}{}, m.ttl)
+	return nil
+}
+
+// WithDeduplication returns an Option that skips events that have already been handled, using the store to record
+// handled events. Events are identified using the provided keys, an event is skipped if any of its keys have been
+// seen. Defaults to DeduplicateByEventID if no keys are provided. Events are only recorded once they have been
+// handled successfully.
+func WithDeduplication(store DeduplicationStore, keys ...DeduplicationKey) Option {
+	if len(keys) == 0 {
+		keys = []DeduplicationKey{DeduplicateByEventID}
+	}
+
+	return func(eh *EventHandler) {
+		eh.deduplicator = &deduplicator{store: store, keys: keys}
+	}
+}
+
+// guard returns an event.Handler that invokes next for events that have not already been seen.
+func (d *deduplicator) guard(next event.Handler, m *consumerMetrics) event.Handler {
+	return func(ctx context.Context, evt event.Event) error {
+		keys, seen, err := d.seen(ctx, evt)
+		switch {
+		case err != nil:
+			return err
+		case seen:
+			m.duplicatesSkipped.WithLabelValues(evt.Type()).Inc()
+			return nil
+		}
+
+		if err = next(ctx, evt); err != nil {
+			return err
+		}
+
+		return d.markSeen(ctx, keys)
+	}
+}
+
+// seen returns the keys identifying the event, and whether any of them have already been seen.
+func (d *deduplicator) seen(ctx context.Context, evt event.Event) ([]string, bool, error) {
+	keys, err := d.eventKeys(evt)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, key := range keys {
+		seen, err := d.store.Seen(ctx, key)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to check deduplication store: %w", err)
+		}
+
+		if seen {
+			return keys, true, nil
+		}
+	}
+
+	return keys, false, nil
+}
+
+// markSeen records that each of the keys identifying a handled event have been seen.
+func (d *deduplicator) markSeen(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		if err := d.store.MarkSeen(ctx, key); err != nil {
+			return fmt.Errorf("failed to update deduplication store: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (d *deduplicator) eventKeys(evt event.Event) ([]string, error) {
+	keys := make([]string, 0, len(d.keys))
+	for _, key := range d.keys {
+		switch key {
+		case DeduplicateByEventID:
+			keys = append(keys, "id/"+evt.ID)
+		case DeduplicateByResourceVersion:
+			version, err := resourceVersion(evt)
+			if err != nil {
+				return nil, err
+			}
+
+			if version != "" {
+				keys = append(keys, "version/"+version)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported deduplication key %q", key)
+		}
+	}
+
+	return keys, nil
+}
+
+// resourceVersion returns a string that identifies the version of the resource described by the event, made up of
+// its cluster, UID and resource version. Deleted resources have no resource version, so they are identified by their
+// cluster and UID. Returns a blank string for events that do not describe a resource.
+func resourceVersion(evt event.Event) (string, error) {
+	var (
+		clusterID string
+		uid       string
+		obj       []byte
+	)
+
+	switch payload := evt.Payload.(type) {
+	case *resource.ResourceCreatedEvent:
+		clusterID, uid, obj = payload.GetClusterId(), payload.GetUid(), payload.GetResource()
+	case *resource.ResourceUpdatedEvent:
+		clusterID, uid, obj = payload.GetClusterId(), payload.GetUid(), payload.GetNow()
+	case *resource.ResourceDeletedEvent:
+		return payload.GetClusterId() + "/" + payload.GetUid() + "/deleted", nil
+	default:
+		return "", nil
+	}
+
+	version, err := parseResourceVersion(uid, obj)
+	if err != nil || version == "" {
+		return "", err
+	}
+
+	return clusterID + "/" + uid + "/" + version, nil
+}
+
+// parseResourceVersion returns the resource version of the JSON-encoded resource.
+func parseResourceVersion(uid string, obj []byte) (string, error) {
+	var partial struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+	}
+
+	if err := json.Unmarshal(obj, &partial); err != nil {
+		return "", fmt.Errorf("failed to unmarshal resource %s: %w", uid, err)
+	}
+
+	return partial.Metadata.ResourceVersion, nil
+}
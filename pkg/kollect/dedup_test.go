@@ -0,0 +1,159 @@
+package kollect_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/davidsbond/kollect/internal/event"
+	"github.com/davidsbond/kollect/pkg/kollect"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+func TestMemoryDeduplicationStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := kollect.NewMemoryDeduplicationStore(10, time.Millisecond*50)
+
+	seen, err := store.Seen(ctx, "test")
+	require.NoError(t, err)
+	assert.False(t, seen)
+
+	require.NoError(t, store.MarkSeen(ctx, "test"))
+
+	seen, err = store.Seen(ctx, "test")
+	require.NoError(t, err)
+	assert.True(t, seen)
+
+	time.Sleep(time.Millisecond * 100)
+
+	seen, err = store.Seen(ctx, "test")
+	require.NoError(t, err)
+	assert.False(t, seen)
+}
+
+func TestEventHandler_HandleDuplicates(t *testing.T) {
+	t.Parallel()
+
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":            "example",
+				"namespace":       "namespace",
+				"uid":             "test",
+				"resourceVersion": "1",
+			},
+		},
+	}
+
+	created := event.New(&resource.ResourceCreatedEvent{
+		Uid:       "test",
+		Resource:  mustMarshal(t, obj),
+		ClusterId: "test",
+	})
+
+	republished := event.New(created.Payload)
+
+	tt := []struct {
+		Name            string
+		Keys            []kollect.DeduplicationKey
+		Events          []event.Event
+		ExpectedHandled int
+	}{
+		{
+			Name:            "It should skip events with the same identifier",
+			Events:          []event.Event{created, created},
+			ExpectedHandled: 1,
+		},
+		{
+			Name:            "It should skip events with the same resource version",
+			Keys:            []kollect.DeduplicationKey{kollect.DeduplicateByResourceVersion},
+			Events:          []event.Event{created, republished},
+			ExpectedHandled: 1,
+		},
+		{
+			Name:            "It should not skip events with different identifiers",
+			Keys:            []kollect.DeduplicationKey{kollect.DeduplicateByEventID},
+			Events:          []event.Event{created, republished},
+			ExpectedHandled: 2,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			url := fmt.Sprintf("mem://duplicates-%d", i)
+			writer, err := event.NewWriter(ctx, url)
+			require.NoError(t, err)
+			defer writer.Close()
+
+			store := &countingStore{
+				DeduplicationStore: kollect.NewMemoryDeduplicationStore(10, time.Minute),
+				total:              len(tc.Events),
+				done:               cancel,
+			}
+
+			handler, err := kollect.NewEventHandler(ctx, url, kollect.WithDeduplication(store, tc.Keys...))
+			require.NoError(t, err)
+
+			for _, evt := range tc.Events {
+				require.NoError(t, writer.Write(ctx, evt))
+			}
+
+			handled := 0
+			handler.OnResourceCreated(func(ctx context.Context, clusterID string, obj *unstructured.Unstructured) error {
+				handled++
+				return nil
+			})
+
+			require.NoError(t, handler.Handle(ctx))
+			assert.Equal(t, tc.ExpectedHandled, handled)
+		})
+	}
+}
+
+// The countingStore type wraps a DeduplicationStore and invokes done once all events have either been skipped or
+// marked as seen.
+type countingStore struct {
+	kollect.DeduplicationStore
+
+	mux   sync.Mutex
+	count int
+	total int
+	done  func()
+}
+
+func (s *countingStore) Seen(ctx context.Context, key string) (bool, error) {
+	seen, err := s.DeduplicationStore.Seen(ctx, key)
+	if seen {
+		s.increment()
+	}
+
+	return seen, err
+}
+
+func (s *countingStore) MarkSeen(ctx context.Context, key string) error {
+	defer s.increment()
+	return s.DeduplicationStore.MarkSeen(ctx, key)
+}
+
+func (s *countingStore) increment() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.count++
+	if s.count == s.total {
+		s.done()
+	}
+}
@@ -0,0 +1,259 @@
+package kollect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/davidsbond/kollect/internal/event"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+type (
+	// The filter type determines which events are passed to the registered handlers. Each field is optional, an
+	// event must match all fields that are set.
+	filter struct {
+		gvks       []schema.GroupVersionKind
+		namespaces []string
+		selector   labels.Selector
+		clusters   []string
+		types      []string
+	}
+
+	// The filterTarget type contains the fields of an event that filters are evaluated against.
+	filterTarget struct {
+		gvk       schema.GroupVersionKind
+		namespace string
+		labels    labels.Set
+		clusterID string
+	}
+)
+
+// Supported values for WithEventTypes.
+const (
+	EventTypeCreated = event.TypeResourceCreated
+	EventTypeUpdated = event.TypeResourceUpdated
+	EventTypeDeleted = event.TypeResourceDeleted
+)
+
+// WithGroupVersionKinds returns an Option that only handles events for resources of the given groups, versions and
+// kinds.
+func WithGroupVersionKinds(gvks ...schema.GroupVersionKind) Option {
+	return func(eh *EventHandler) {
+		eh.filter().gvks = append(eh.filter().gvks, gvks...)
+	}
+}
+
+// WithNamespaces returns an Option that only handles events for resources within the given namespaces.
+func WithNamespaces(namespaces ...string) Option {
+	return func(eh *EventHandler) {
+		eh.filter().namespaces = append(eh.filter().namespaces, namespaces...)
+	}
+}
+
+// WithLabelSelector returns an Option that only handles events for resources whose labels match the given selector.
+func WithLabelSelector(selector labels.Selector) Option {
+	return func(eh *EventHandler) {
+		eh.filter().selector = selector
+	}
+}
+
+// WithClusters returns an Option that only handles events for resources within the given clusters.
+func WithClusters(clusterIDs ...string) Option {
+	return func(eh *EventHandler) {
+		eh.filter().clusters = append(eh.filter().clusters, clusterIDs...)
+	}
+}
+
+// WithEventTypes returns an Option that only handles events of the given types, see the EventType constants for
+// possible values.
+func WithEventTypes(types ...string) Option {
+	return func(eh *EventHandler) {
+		eh.filter().types = append(eh.filter().types, types...)
+	}
+}
+
+// filter returns the EventHandler's filter, creating it if it does not exist.
+func (eh *EventHandler) filter() *filter {
+	if eh.eventFilter == nil {
+		eh.eventFilter = &filter{}
+	}
+
+	return eh.eventFilter
+}
+
+// readerFilter returns a function used by the Reader to skip events whose attributes do not match the filter,
+// before the events referenced by claim checks are fetched.
+func (f *filter) readerFilter(m *consumerMetrics) func(evt event.Event) bool {
+	return func(evt event.Event) bool {
+		if f.matchesAttributes(evt) {
+			return true
+		}
+
+		m.filtered(evt)
+		return false
+	}
+}
+
+// guard returns an event.Handler that invokes next for events that match the filter.
+func (f *filter) guard(next event.Handler, m *consumerMetrics) event.Handler {
+	return func(ctx context.Context, evt event.Event) error {
+		ok, err := f.matches(evt)
+		switch {
+		case err != nil:
+			return err
+		case !ok:
+			m.filtered(evt)
+			return nil
+		default:
+			return next(ctx, evt)
+		}
+	}
+}
+
+// matches returns true if the event matches the filter. Filters are evaluated using the event attributes where
+// possible, falling back to decoding the resource for events published without them. Deleted events published
+// without attributes do not contain enough information to be filtered by group, version, kind, namespace or labels,
+// so always match those filters.
+func (f *filter) matches(evt event.Event) (bool, error) {
+	if !event.MatchesAny(f.types, evt.Type()) {
+		return false, nil
+	}
+
+	target, ok, err := newFilterTarget(evt)
+	switch {
+	case err != nil:
+		return false, err
+	case !event.MatchesAny(f.clusters, target.clusterID):
+		return false, nil
+	case !ok:
+		return true, nil
+	default:
+		return f.matchesTarget(target), nil
+	}
+}
+
+// matchesAttributes returns false if the event's attributes show that it does not match the filter. It is used by
+// the Reader before the event referenced by a claim check is fetched, so only uses the payload to determine the type
+// of events that are not claim checked. Events that cannot be evaluated using their attributes match, and are
+// evaluated again using matches once they have been fully decoded.
+func (f *filter) matchesAttributes(evt event.Event) bool {
+	switch typ := evt.Type(); typ {
+	case EventTypeCreated, EventTypeUpdated, EventTypeDeleted:
+		if !event.MatchesAny(f.types, typ) {
+			return false
+		}
+	}
+
+	if clusterID := evt.Attributes[event.AttributeClusterID]; clusterID != "" && !event.MatchesAny(f.clusters, clusterID) {
+		return false
+	}
+
+	target, ok, err := attributeTarget(evt)
+	if err != nil || !ok {
+		return true
+	}
+
+	return f.matchesTarget(target)
+}
+
+// matchesTarget returns true if the group, version, kind, namespace and labels of the target match the filter.
+func (f *filter) matchesTarget(target filterTarget) bool {
+	if len(f.gvks) > 0 && !containsGVK(f.gvks, target.gvk) {
+		return false
+	}
+
+	if !event.MatchesAny(f.namespaces, target.namespace) {
+		return false
+	}
+
+	if f.selector != nil && !f.selector.Matches(target.labels) {
+		return false
+	}
+
+	return true
+}
+
+// newFilterTarget returns the fields of the event that filters are evaluated against. Returns false if only the
+// cluster is known.
+func newFilterTarget(evt event.Event) (filterTarget, bool, error) {
+	var (
+		target filterTarget
+		obj    []byte
+	)
+
+	switch payload := evt.Payload.(type) {
+	case *resource.ResourceCreatedEvent:
+		target.clusterID, obj = payload.GetClusterId(), payload.GetResource()
+	case *resource.ResourceUpdatedEvent:
+		target.clusterID, obj = payload.GetClusterId(), payload.GetNow()
+	case *resource.ResourceDeletedEvent:
+		target.clusterID = payload.GetClusterId()
+	}
+
+	if attrs, ok, err := attributeTarget(evt); ok || err != nil {
+		attrs.clusterID = target.clusterID
+		return attrs, ok, err
+	}
+
+	if obj == nil {
+		return target, false, nil
+	}
+
+	var partial struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Metadata   struct {
+			Namespace string            `json:"namespace"`
+			Labels    map[string]string `json:"labels"`
+		} `json:"metadata"`
+	}
+
+	if err := json.Unmarshal(obj, &partial); err != nil {
+		return target, false, fmt.Errorf("failed to unmarshal resource for event %s: %w", evt.ID, err)
+	}
+
+	target.gvk = schema.FromAPIVersionAndKind(partial.APIVersion, partial.Kind)
+	target.namespace = partial.Metadata.Namespace
+	target.labels = partial.Metadata.Labels
+	return target, true, nil
+}
+
+// attributeTarget returns the group, version, kind, namespace and labels of the event's resource using its
+// attributes. Returns false for events published without them.
+func attributeTarget(evt event.Event) (filterTarget, bool, error) {
+	attributes := evt.Attributes
+	if attributes[event.AttributeKind] == "" {
+		return filterTarget{}, false, nil
+	}
+
+	target := filterTarget{
+		gvk: schema.GroupVersionKind{
+			Group:   attributes[event.AttributeGroup],
+			Version: attributes[event.AttributeVersion],
+			Kind:    attributes[event.AttributeKind],
+		},
+		namespace: attributes[event.AttributeNamespace],
+	}
+
+	set, err := labels.ConvertSelectorToLabelsMap(attributes[event.AttributeLabels])
+	if err != nil {
+		return target, false, fmt.Errorf("failed to parse labels of event %s: %w", evt.ID, err)
+	}
+
+	target.labels = set
+	return target, true, nil
+}
+
+func containsGVK(gvks []schema.GroupVersionKind, gvk schema.GroupVersionKind) bool {
+	for _, v := range gvks {
+		if v == gvk {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,188 @@
+package kollect_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/davidsbond/kollect/internal/event"
+	"github.com/davidsbond/kollect/pkg/kollect"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+func TestEventHandler_HandleFiltered(t *testing.T) {
+	t.Parallel()
+
+	deployments := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	attributes := map[string]string{
+		event.AttributeClusterID: "test",
+		event.AttributeGroup:     "apps",
+		event.AttributeVersion:   "v1",
+		event.AttributeKind:      "Deployment",
+		event.AttributeNamespace: "production",
+		event.AttributeLabels:    "app=example",
+	}
+
+	created := func(t *testing.T, attributes map[string]string) event.Event {
+		t.Helper()
+
+		return event.New(&resource.ResourceCreatedEvent{
+			Uid:       "test",
+			Resource:  mustMarshal(t, object("apps/v1", "Deployment", "production", "test", map[string]string{"app": "example"})),
+			ClusterId: "test",
+		}, event.WithAttributes(attributes))
+	}
+
+	tt := []struct {
+		Name      string
+		Option    kollect.Option
+		Event     event.Event
+		ExpectsOK bool
+	}{
+		{
+			Name:      "It should handle events matching a group, version and kind",
+			Option:    kollect.WithGroupVersionKinds(deployments),
+			Event:     created(t, attributes),
+			ExpectsOK: true,
+		},
+		{
+			Name:   "It should filter events not matching a group, version and kind",
+			Option: kollect.WithGroupVersionKinds(schema.GroupVersionKind{Version: "v1", Kind: "Pod"}),
+			Event:  created(t, attributes),
+		},
+		{
+			Name:      "It should handle events matching a namespace without attributes",
+			Option:    kollect.WithNamespaces("production"),
+			Event:     created(t, nil),
+			ExpectsOK: true,
+		},
+		{
+			Name:   "It should filter events not matching a namespace without attributes",
+			Option: kollect.WithNamespaces("staging"),
+			Event:  created(t, nil),
+		},
+		{
+			Name:      "It should handle events matching a label selector",
+			Option:    kollect.WithLabelSelector(labels.SelectorFromSet(labels.Set{"app": "example"})),
+			Event:     created(t, attributes),
+			ExpectsOK: true,
+		},
+		{
+			Name:   "It should filter events not matching a label selector",
+			Option: kollect.WithLabelSelector(labels.SelectorFromSet(labels.Set{"app": "other"})),
+			Event:  created(t, attributes),
+		},
+		{
+			Name:   "It should filter events not matching a cluster",
+			Option: kollect.WithClusters("other"),
+			Event:  created(t, attributes),
+		},
+		{
+			Name:   "It should filter events not matching an event type",
+			Option: kollect.WithEventTypes(kollect.EventTypeDeleted),
+			Event:  created(t, attributes),
+		},
+		{
+			Name:   "It should handle deleted events without attributes",
+			Option: kollect.WithGroupVersionKinds(deployments),
+			Event: event.New(&resource.ResourceDeletedEvent{
+				Uid:       "test",
+				ClusterId: "test",
+			}),
+			ExpectsOK: true,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			// Filtered events are not passed to any handler, so the handler is given a short time to handle the event
+			// before checking the result.
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*250)
+			defer cancel()
+
+			url := fmt.Sprintf("mem://filter-%d", i)
+			writer, err := event.NewWriter(ctx, url)
+			require.NoError(t, err)
+			defer writer.Close()
+
+			handler, err := kollect.NewEventHandler(ctx, url, tc.Option)
+			require.NoError(t, err)
+
+			var handled int32
+			handler.OnResourceCreated(func(ctx context.Context, clusterID string, obj *unstructured.Unstructured) error {
+				atomic.AddInt32(&handled, 1)
+				cancel()
+				return nil
+			})
+
+			handler.OnResourceDeleted(func(ctx context.Context, clusterID, resourceUID string) error {
+				atomic.AddInt32(&handled, 1)
+				cancel()
+				return nil
+			})
+
+			require.NoError(t, writer.Write(ctx, tc.Event))
+			require.NoError(t, handler.Handle(ctx))
+			assert.Equal(t, tc.ExpectsOK, atomic.LoadInt32(&handled) == 1)
+		})
+	}
+}
+
+func TestEventHandler_HandleFilteredClaimCheck(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir := t.TempDir()
+	bucketURL := "file://" + dir
+	writer, err := event.NewWriter(ctx, "mem://filter-claim-check", event.WithClaimCheck(bucketURL, 0))
+	require.NoError(t, err)
+	defer writer.Close()
+
+	handler, err := kollect.NewEventHandler(ctx, "mem://filter-claim-check",
+		kollect.WithClaimCheckBucket(bucketURL),
+		kollect.WithGroupVersionKinds(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}),
+	)
+	require.NoError(t, err)
+
+	var handled []string
+	handler.OnResourceCreated(func(ctx context.Context, clusterID string, obj *unstructured.Unstructured) error {
+		handled = append(handled, obj.GetName())
+		cancel()
+		return nil
+	})
+
+	// The filtered event's blob is removed, so handling fails if it is fetched before the filter is evaluated.
+	filtered := event.New(&resource.ResourceCreatedEvent{
+		Uid:       "pod",
+		Resource:  mustMarshal(t, object("v1", "Pod", "default", "pod", nil)),
+		ClusterId: "test",
+	}, event.WithAttributes(map[string]string{event.AttributeVersion: "v1", event.AttributeKind: "Pod"}))
+
+	require.NoError(t, writer.Write(ctx, filtered))
+	require.NoError(t, os.Remove(filepath.Join(dir, filtered.ID)))
+
+	require.NoError(t, writer.Write(ctx, event.New(&resource.ResourceCreatedEvent{
+		Uid:       "deployment",
+		Resource:  mustMarshal(t, object("apps/v1", "Deployment", "default", "deployment", nil)),
+		ClusterId: "test",
+	}, event.WithAttributes(map[string]string{
+		event.AttributeGroup:   "apps",
+		event.AttributeVersion: "v1",
+		event.AttributeKind:    "Deployment",
+	}))))
+
+	require.NoError(t, handler.Handle(ctx))
+	assert.Equal(t, []string{"deployment"}, handled)
+}
@@ -5,22 +5,47 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
-	"golang.org/x/sync/errgroup"
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
 
 	"github.com/davidsbond/kollect/internal/event"
+	"github.com/davidsbond/kollect/internal/metrics"
+	"github.com/davidsbond/kollect/internal/tracing"
 	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
 )
 
 type (
 	// The EventHandler type is used to handle specific events published by kollect from a supported event bus.
 	EventHandler struct {
-		reader *event.Reader
+		reader        *event.Reader
+		readerOpts    []event.ReaderOption
+		handler       event.Handler
+		deduplicator  *deduplicator
+		staleGuard    *staleGuard
+		eventFilter   *filter
+		middleware    []Middleware
+		metricsConfig metrics.Config
+		metrics       *consumerMetrics
 
-		onResourceCreated ResourceCreatedHandler
-		onResourceUpdated ResourceUpdatedHandler
-		onResourceDeleted ResourceDeletedHandler
+		tracerProvider trace.TracerProvider
+		tracer         trace.Tracer
+		logger         *logr.Logger
+
+		onResourceCreated []ResourceCreatedHandler
+		onResourceUpdated []ResourceUpdatedHandler
+		onResourceDeleted []ResourceDeletedHandler
+		onStaleEvent      []StaleEventHandler
+
+		// Handlers for resources decoded into concrete types using the scheme, keyed by their group, version and
+		// kind.
+		scheme *runtime.Scheme
+		typed  map[schema.GroupVersionKind]*typedHandlers
 	}
 
 	// The ResourceCreatedHandler type is a function that is invoked when the EventHandler consumes an event indicating
@@ -34,66 +59,229 @@ type (
 	// The ResourceDeletedHandler type is a function that is invoked when the EventHandler consumes an event indicating
 	// that an existing cluster resource was deleted.
 	ResourceDeletedHandler func(ctx context.Context, clusterID, resourceUID string) error
+
+	// The Option type is a function that can modify the behaviour of an EventHandler.
+	Option func(eh *EventHandler)
+
+	// The DeadLetter type describes a message that the EventHandler could not decode or handle.
+	DeadLetter struct {
+		// The original body of the message.
+		Body []byte
+		// The original metadata of the message.
+		Metadata map[string]string
+		// The identifier of the event, this is blank if the message could not be decoded.
+		EventID string
+		// The number of times handling the event was attempted.
+		Attempts int
+		// The error returned by the final attempt.
+		Err error
+	}
+
+	// The DeadLetterHandler type is a function that is invoked when the EventHandler could not decode or handle a
+	// message. If the function returns nil, the message is acknowledged.
+	DeadLetterHandler func(ctx context.Context, dl DeadLetter) error
 )
 
 // NewEventHandler returns a new instance of the EventHandler type that connects to the event bus described in the
 // provided url.
-func NewEventHandler(ctx context.Context, urlStr string) (*EventHandler, error) {
-	reader, err := event.NewReader(ctx, urlStr)
+func NewEventHandler(ctx context.Context, urlStr string, opts ...Option) (*EventHandler, error) {
+	eh := &EventHandler{
+		scheme: scheme.Scheme,
+		typed:  make(map[schema.GroupVersionKind]*typedHandlers),
+	}
+
+	for _, opt := range opts {
+		opt(eh)
+	}
+
+	m, err := newMetrics(eh.metricsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	eh.metrics = m
+	eh.tracer = tracing.Tracer(eh.tracerProvider)
+	eh.readerOpts = append(eh.readerOpts,
+		event.WithNackHook(m.nacked),
+		event.WithReaderMetrics(eh.metricsConfig),
+		event.WithReaderTracerProvider(eh.tracerProvider),
+	)
+
+	if eh.eventFilter != nil {
+		eh.readerOpts = append(eh.readerOpts, event.WithFilter(eh.eventFilter.readerFilter(m)))
+	}
+
+	reader, err := event.NewReader(ctx, urlStr, eh.readerOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to event bus: %w", err)
 	}
 
-	return &EventHandler{reader: reader}, nil
+	eh.reader = reader
+	eh.handler = eh.instrument(chain(eh.dispatch, eh.middleware))
+	if eh.staleGuard != nil {
+		eh.handler = eh.staleGuard.guard(eh.handler, eh.handleStaleEvent, m)
+	}
+
+	if eh.deduplicator != nil {
+		eh.handler = eh.deduplicator.guard(eh.handler, m)
+	}
+
+	if eh.eventFilter != nil {
+		eh.handler = eh.eventFilter.guard(eh.handler, m)
+	}
+
+	return eh, nil
+}
+
+// WithWorkers returns an Option that sets the number of events the EventHandler will handle concurrently. Events
+// for the same resource are always handled in the order they are received. Defaults to 1.
+func WithWorkers(n int) Option {
+	return func(eh *EventHandler) {
+		eh.readerOpts = append(eh.readerOpts, event.WithWorkers(n))
+	}
+}
+
+// WithRetry returns an Option that sets the maximum number of times a handler is invoked for an event before the
+// event is considered failed. The EventHandler waits for the backoff duration between the first and second attempts,
+// doubling it for each attempt after that. Defaults to a single attempt.
+func WithRetry(maxAttempts int, backoff time.Duration) Option {
+	return func(eh *EventHandler) {
+		eh.readerOpts = append(eh.readerOpts, event.WithRetry(maxAttempts, backoff))
+	}
+}
+
+// WithDrainTimeout returns an Option that sets how long events that are being handled when Handle or HandleBatch
+// returns are given to finish, after which the context given to handlers is cancelled. Defaults to 30 seconds.
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(eh *EventHandler) {
+		eh.readerOpts = append(eh.readerOpts, event.WithDrainTimeout(timeout))
+	}
+}
+
+// WithClaimCheckBucket returns an Option that allows the EventHandler to fetch events from the blob storage bucket
+// identified using the given URL, which must match the claim check URL the events were written with. Claim checks
+// referencing any other bucket cannot be decoded, so are failed. Can be used multiple times to allow multiple
+// buckets.
+func WithClaimCheckBucket(urlStr string) Option {
+	return func(eh *EventHandler) {
+		eh.readerOpts = append(eh.readerOpts, event.WithClaimCheckBucket(urlStr))
+	}
+}
+
+// WithDeadLetterURL returns an Option that forwards messages that could not be decoded, or that failed to be handled
+// once all attempts are exhausted, to the event bus described in the provided url. Forwarded messages contain
+// "dead-letter-error" and "dead-letter-attempts" metadata describing the failure.
+func WithDeadLetterURL(urlStr string) Option {
+	return func(eh *EventHandler) {
+		eh.readerOpts = append(eh.readerOpts, event.WithDeadLetterTopic(urlStr))
+	}
 }
 
-// OnResourceCreated sets up a ResourceCreatedHandler implementation to be invoked whenever an event that indicates a
-// new resource is consumed.
+// WithDeadLetterHandler returns an Option that invokes fn for messages that could not be decoded, or that failed to
+// be handled once all attempts are exhausted.
+func WithDeadLetterHandler(fn DeadLetterHandler) Option {
+	return func(eh *EventHandler) {
+		eh.readerOpts = append(eh.readerOpts, event.WithDeadLetter(func(ctx context.Context, dl event.DeadLetter) error {
+			return fn(ctx, DeadLetter(dl))
+		}))
+	}
+}
+
+// WithContinueOnError returns an Option that causes the EventHandler to continue handling events when a message
+// could not be decoded or handled and was not dead lettered, rather than returning an error from Handle. Failed
+// messages are nacked, so may be redelivered depending on the event bus.
+func WithContinueOnError() Option {
+	return func(eh *EventHandler) {
+		eh.readerOpts = append(eh.readerOpts, event.WithContinueOnError())
+	}
+}
+
+// OnResourceCreated adds a ResourceCreatedHandler implementation to be invoked whenever an event that indicates a
+// new resource is consumed. Handlers are invoked in the order they were added, if a handler returns an error the
+// remaining handlers are not invoked.
 func (eh *EventHandler) OnResourceCreated(fn ResourceCreatedHandler) {
-	eh.onResourceCreated = fn
+	eh.onResourceCreated = append(eh.onResourceCreated, fn)
 }
 
-// OnResourceUpdated sets up a ResourceUpdatedHandler implementation to be invoked whenever an event that indicates an
-// existing resource has been modified.
+// OnResourceUpdated adds a ResourceUpdatedHandler implementation to be invoked whenever an event that indicates an
+// existing resource has been modified. Handlers are invoked in the order they were added, if a handler returns an
+// error the remaining handlers are not invoked.
 func (eh *EventHandler) OnResourceUpdated(fn ResourceUpdatedHandler) {
-	eh.onResourceUpdated = fn
+	eh.onResourceUpdated = append(eh.onResourceUpdated, fn)
 }
 
-// OnResourceDeleted sets up a ResourceDeletedHandler implementation to be invoked whenever an event that indicates an
-// existing resource has been deleted.
+// OnResourceDeleted adds a ResourceDeletedHandler implementation to be invoked whenever an event that indicates an
+// existing resource has been deleted. Handlers are invoked in the order they were added, if a handler returns an
+// error the remaining handlers are not invoked.
 func (eh *EventHandler) OnResourceDeleted(fn ResourceDeletedHandler) {
-	eh.onResourceDeleted = fn
+	eh.onResourceDeleted = append(eh.onResourceDeleted, fn)
 }
 
 // Handle inbound events, invoking any registered handler functions for their respective event types. This method
-// blocks until the provided context is cancelled or one of the registered handler functions returns a non-nil
-// error.
+// blocks until the provided context is cancelled or an event could not be handled, see WithRetry, WithDeadLetterURL,
+// WithDeadLetterHandler and WithContinueOnError for changing how failed events are handled. When the context is
+// cancelled, events that are already being handled are allowed to finish before the connection to the event bus is
+// closed and nil is returned. Use MetadataFromContext within handler functions to access the metadata of the event
+// being handled.
 func (eh *EventHandler) Handle(ctx context.Context) error {
-	grp, ctx := errgroup.WithContext(ctx)
-	grp.Go(func() error {
-		return eh.reader.Read(ctx, func(ctx context.Context, evt event.Event) error {
-			switch payload := evt.Payload.(type) {
-			case *resource.ResourceCreatedEvent:
-				return eh.handleResourceCreatedEvent(ctx, payload)
-			case *resource.ResourceUpdatedEvent:
-				return eh.handleResourceUpdatedEvent(ctx, payload)
-			case *resource.ResourceDeletedEvent:
-				return eh.handleResourceDeletedEvent(ctx, payload)
-			default:
-				return nil
-			}
-		})
-	})
-	grp.Go(func() error {
-		<-ctx.Done()
-		return eh.reader.Close()
-	})
-
-	return grp.Wait()
+	err := eh.reader.Read(eh.contextWithLogger(ctx), eh.handle)
+
+	if closeErr := eh.reader.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (eh *EventHandler) handle(ctx context.Context, evt event.Event) error {
+	ctx = contextWithEventLogger(contextWithMetadata(ctx, evt), evt)
+	if err := eh.handler(ctx, evt); err != nil {
+		return err
+	}
+
+	eh.metrics.observeLatency(evt)
+	return nil
+}
+
+// instrument returns an event.Handler that records the duration, errors and number of in-flight invocations of next,
+// invoking it within a span that is a child of the span created by the reader.
+func (eh *EventHandler) instrument(next event.Handler) event.Handler {
+	return func(ctx context.Context, evt event.Event) error {
+		typ := evt.Type()
+		start := time.Now()
+
+		ctx, span := eh.startSpan(ctx, evt)
+		defer span.End()
+
+		eh.metrics.inFlight.WithLabelValues(typ).Inc()
+		defer eh.metrics.inFlight.WithLabelValues(typ).Dec()
+
+		err := next(ctx, evt)
+		eh.metrics.handlerDuration.WithLabelValues(typ).Observe(time.Since(start).Seconds())
+		if err != nil {
+			eh.metrics.handlerErrors.WithLabelValues(typ).Inc()
+			tracing.Fail(span, err)
+		}
+
+		return err
+	}
+}
+
+func (eh *EventHandler) dispatch(ctx context.Context, evt event.Event) error {
+	switch payload := evt.Payload.(type) {
+	case *resource.ResourceCreatedEvent:
+		return eh.handleResourceCreatedEvent(ctx, payload)
+	case *resource.ResourceUpdatedEvent:
+		return eh.handleResourceUpdatedEvent(ctx, payload)
+	case *resource.ResourceDeletedEvent:
+		return eh.handleResourceDeletedEvent(ctx, evt, payload)
+	default:
+		return nil
+	}
 }
 
 func (eh *EventHandler) handleResourceCreatedEvent(ctx context.Context, payload *resource.ResourceCreatedEvent) error {
-	if eh.onResourceCreated == nil {
+	if len(eh.onResourceCreated) == 0 && len(eh.typed) == 0 {
 		return nil
 	}
 
@@ -102,11 +290,17 @@ func (eh *EventHandler) handleResourceCreatedEvent(ctx context.Context, payload
 		return fmt.Errorf("failed to unmarshal resource %s: %w", payload.GetUid(), err)
 	}
 
-	return eh.onResourceCreated(ctx, payload.GetClusterId(), &obj)
+	for _, fn := range eh.onResourceCreated {
+		if err := fn(ctx, payload.GetClusterId(), &obj); err != nil {
+			return err
+		}
+	}
+
+	return eh.handleObjectCreated(ctx, payload.GetClusterId(), &obj)
 }
 
 func (eh *EventHandler) handleResourceUpdatedEvent(ctx context.Context, payload *resource.ResourceUpdatedEvent) error {
-	if eh.onResourceUpdated == nil {
+	if len(eh.onResourceUpdated) == 0 && len(eh.typed) == 0 {
 		return nil
 	}
 
@@ -119,13 +313,21 @@ func (eh *EventHandler) handleResourceUpdatedEvent(ctx context.Context, payload
 		return fmt.Errorf("failed to unmarshal resource %s: %w", payload.GetUid(), err)
 	}
 
-	return eh.onResourceUpdated(ctx, payload.GetClusterId(), &then, &now)
+	for _, fn := range eh.onResourceUpdated {
+		if err := fn(ctx, payload.GetClusterId(), &then, &now); err != nil {
+			return err
+		}
+	}
+
+	return eh.handleObjectUpdated(ctx, payload.GetClusterId(), &then, &now)
 }
 
-func (eh *EventHandler) handleResourceDeletedEvent(ctx context.Context, payload *resource.ResourceDeletedEvent) error {
-	if eh.onResourceDeleted == nil {
-		return nil
+func (eh *EventHandler) handleResourceDeletedEvent(ctx context.Context, evt event.Event, payload *resource.ResourceDeletedEvent) error {
+	for _, fn := range eh.onResourceDeleted {
+		if err := fn(ctx, payload.GetClusterId(), payload.GetUid()); err != nil {
+			return err
+		}
 	}
 
-	return eh.onResourceDeleted(ctx, payload.GetClusterId(), payload.GetUid())
+	return eh.handleObjectDeleted(ctx, evt, payload.GetClusterId(), payload.GetUid())
 }
@@ -2,11 +2,19 @@ package kollect_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/davidsbond/kollect/internal/event"
 	"github.com/davidsbond/kollect/pkg/kollect"
@@ -115,55 +123,490 @@ func TestEventHandler_Handle(t *testing.T) {
 		},
 	}
 
-	for _, tc := range tt {
+	encodings := []event.Encoding{
+		event.EncodingProto,
+		event.EncodingJSON,
+		event.EncodingCloudEventsStructured,
+		event.EncodingCloudEventsBinary,
+	}
+
+	for _, encoding := range encodings {
+		for _, tc := range tt {
+			t.Run(string(encoding)+"/"+tc.Name, func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				writer, err := event.NewWriter(ctx, "mem://test?encoding="+string(encoding))
+				require.NoError(t, err)
+
+				handler, err := kollect.NewEventHandler(ctx, "mem://test")
+				require.NoError(t, err)
+				require.NoError(t, writer.Write(ctx, tc.Event))
+
+				handler.OnResourceCreated(func(ctx context.Context, clusterID string, obj *unstructured.Unstructured) error {
+					cancel()
+					assertMetadata(t, ctx, tc.Event)
+
+					assert.EqualValues(t, tc.ExpectedClusterID, clusterID)
+					assert.EqualValues(t, tc.ExpectedResource, obj)
+					return nil
+				})
+
+				handler.OnResourceUpdated(func(ctx context.Context, clusterID string, then, now *unstructured.Unstructured) error {
+					cancel()
+					assertMetadata(t, ctx, tc.Event)
+
+					assert.EqualValues(t, tc.ExpectedClusterID, clusterID)
+					assert.EqualValues(t, tc.ExpectedResource, then)
+					assert.EqualValues(t, tc.ExpectedResource, now)
+					return nil
+				})
+
+				handler.OnResourceDeleted(func(ctx context.Context, clusterID, resourceUID string) error {
+					cancel()
+					assertMetadata(t, ctx, tc.Event)
+
+					assert.EqualValues(t, tc.ExpectedClusterID, clusterID)
+					assert.EqualValues(t, tc.ExpectedResource.GetUID(), resourceUID)
+					return nil
+				})
+
+				err = handler.Handle(ctx)
+				if tc.ExpectsError {
+					assert.Error(t, err)
+					assert.NotEqual(t, context.Canceled, err)
+					return
+				}
+
+				assert.NoError(t, err)
+			})
+		}
+	}
+}
+
+func TestEventHandler_HandleClaimCheck(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	expected := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":      "example",
+				"namespace": "namespace",
+				"uid":       "test",
+			},
+		},
+	}
+
+	bucketURL := "file://" + t.TempDir()
+	writer, err := event.NewWriter(ctx, "mem://claim-check", event.WithClaimCheck(bucketURL, 0))
+	require.NoError(t, err)
+
+	handler, err := kollect.NewEventHandler(ctx, "mem://claim-check", kollect.WithClaimCheckBucket(bucketURL))
+	require.NoError(t, err)
+	require.NoError(t, writer.Write(ctx, event.New(&resource.ResourceCreatedEvent{
+		Uid:       "test",
+		Resource:  mustMarshal(t, expected),
+		ClusterId: "test",
+	})))
+
+	handler.OnResourceCreated(func(ctx context.Context, clusterID string, obj *unstructured.Unstructured) error {
+		cancel()
+
+		assert.EqualValues(t, "test", clusterID)
+		assert.EqualValues(t, expected, obj)
+		return nil
+	})
+
+	assert.NoError(t, handler.Handle(ctx))
+}
+
+func TestEventHandler_HandleClaimCheckNotAllowed(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	writer, err := event.NewWriter(ctx, "mem://claim-check-not-allowed", event.WithClaimCheck("file://"+t.TempDir(), 0))
+	require.NoError(t, err)
+	defer writer.Close()
+
+	// Claim checks referencing a bucket that is not allowed should fail to be decoded, rather than being fetched.
+	handler, err := kollect.NewEventHandler(ctx, "mem://claim-check-not-allowed",
+		kollect.WithClaimCheckBucket("file://"+t.TempDir()),
+		kollect.WithDeadLetterHandler(func(ctx context.Context, dl kollect.DeadLetter) error {
+			defer cancel()
+
+			assert.ErrorContains(t, dl.Err, "is not allowed")
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+
+	handler.OnResourceCreated(func(ctx context.Context, clusterID string, obj *unstructured.Unstructured) error {
+		assert.Fail(t, "handler should not be invoked")
+		return nil
+	})
+
+	require.NoError(t, writer.Write(ctx, event.New(&resource.ResourceCreatedEvent{
+		Uid:       "test",
+		Resource:  mustMarshal(t, &unstructured.Unstructured{}),
+		ClusterId: "test",
+	})))
+
+	assert.NoError(t, handler.Handle(ctx))
+}
+
+func TestEventHandler_HandleConcurrently(t *testing.T) {
+	t.Parallel()
+
+	const (
+		resources = 50
+		versions  = 100
+		burst     = 10
+		total     = resources * versions
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// The in-memory event bus does not deliver messages in the order they were sent, so one that does is used to
+	// check that events for the same resource are handled in order.
+	writer, err := event.NewWriter(ctx, "ordered://concurrent")
+	require.NoError(t, err)
+	defer writer.Close()
+
+	handler, err := kollect.NewEventHandler(ctx, "ordered://concurrent", kollect.WithWorkers(8))
+	require.NoError(t, err)
+
+	// Versions of each resource are written in bursts, so that events for the same resource are received one after
+	// another while events for different resources are still handled concurrently.
+	for first := 1; first <= versions; first += burst {
+		for i := 0; i < resources; i++ {
+			for version := first; version < first+burst; version++ {
+				obj := &unstructured.Unstructured{
+					Object: map[string]interface{}{
+						"apiVersion": "apps/v1",
+						"kind":       "Deployment",
+						"metadata": map[string]interface{}{
+							"name":            "example",
+							"namespace":       "namespace",
+							"uid":             strconv.Itoa(i),
+							"resourceVersion": strconv.Itoa(version),
+						},
+					},
+				}
+
+				require.NoError(t, writer.Write(ctx, event.New(&resource.ResourceUpdatedEvent{
+					Uid:       string(obj.GetUID()),
+					Then:      mustMarshal(t, obj),
+					Now:       mustMarshal(t, obj),
+					ClusterId: "test",
+				})))
+			}
+		}
+	}
+
+	var (
+		mux         sync.Mutex
+		handled     int
+		inFlight    = make(map[types.UID]bool)
+		lastVersion = make(map[types.UID]int)
+	)
+
+	handler.OnResourceUpdated(func(ctx context.Context, clusterID string, then, now *unstructured.Unstructured) error {
+		version, err := strconv.Atoi(now.GetResourceVersion())
+		assert.NoError(t, err)
+
+		mux.Lock()
+		// Events for the same resource should never be handled concurrently, and should be handled in the order
+		// they were written.
+		assert.False(t, inFlight[now.GetUID()])
+		assert.Greater(t, version, lastVersion[now.GetUID()], "resource %s handled out of order", now.GetUID())
+		inFlight[now.GetUID()] = true
+		lastVersion[now.GetUID()] = version
+		mux.Unlock()
+
+		// Handling takes a varying amount of time, so that events would be handled out of order if events for the
+		// same resource were handled by different workers.
+		time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+
+		mux.Lock()
+		defer mux.Unlock()
+
+		inFlight[now.GetUID()] = false
+		handled++
+		if handled == total {
+			cancel()
+		}
+
+		return nil
+	})
+
+	require.NoError(t, handler.Handle(ctx))
+	assert.Equal(t, total, handled)
+	assert.Len(t, lastVersion, resources)
+	for uid, version := range lastVersion {
+		assert.Equal(t, versions, version, "resource %s did not reach its final version", uid)
+	}
+}
+
+func TestEventHandler_HandleDrain(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		Name         string
+		DrainTimeout time.Duration
+		// Invoked by the handler once Handle's context has been cancelled.
+		Handle        func(ctx context.Context) error
+		ExpectedError error
+	}{
+		{
+			Name:         "It should allow events being handled to finish",
+			DrainTimeout: time.Minute,
+			Handle: func(ctx context.Context) error {
+				time.Sleep(time.Millisecond * 50)
+				return ctx.Err()
+			},
+		},
+		{
+			Name:         "It should cancel events still being handled after the drain timeout",
+			DrainTimeout: time.Millisecond * 50,
+			Handle: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			ExpectedError: context.Canceled,
+		},
+	}
+
+	for i, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
-			ctx, cancel := context.WithCancel(context.Background())
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 			defer cancel()
 
-			writer, err := event.NewWriter(ctx, "mem://test")
+			url := fmt.Sprintf("mem://drain-%d", i)
+			writer, err := event.NewWriter(ctx, url)
 			require.NoError(t, err)
+			defer writer.Close()
 
-			handler, err := kollect.NewEventHandler(ctx, "mem://test")
+			handler, err := kollect.NewEventHandler(ctx, url, kollect.WithDrainTimeout(tc.DrainTimeout))
 			require.NoError(t, err)
-			require.NoError(t, writer.Write(ctx, tc.Event))
 
-			handler.OnResourceCreated(func(ctx context.Context, clusterID string, obj *unstructured.Unstructured) error {
+			var handlerErr error
+			handler.OnResourceDeleted(func(handlerCtx context.Context, clusterID, resourceUID string) error {
 				cancel()
-
-				assert.EqualValues(t, tc.ExpectedClusterID, clusterID)
-				assert.EqualValues(t, tc.ExpectedResource, obj)
-				return nil
+				handlerErr = tc.Handle(handlerCtx)
+				return handlerErr
 			})
 
-			handler.OnResourceUpdated(func(ctx context.Context, clusterID string, then, now *unstructured.Unstructured) error {
-				cancel()
+			require.NoError(t, writer.Write(ctx, event.New(&resource.ResourceDeletedEvent{
+				Uid:       "test",
+				ClusterId: "test",
+			})))
 
-				assert.EqualValues(t, tc.ExpectedClusterID, clusterID)
-				assert.EqualValues(t, tc.ExpectedResource, then)
-				assert.EqualValues(t, tc.ExpectedResource, now)
-				return nil
-			})
+			assert.NoError(t, handler.Handle(ctx))
+			assert.Equal(t, tc.ExpectedError, handlerErr)
+		})
+	}
+}
+
+func TestEventHandler_HandleUndecodable(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
 
+	// The in-order event bus is used so that the undecodable message is read before the event.
+	topic, err := pubsub.OpenTopic(ctx, "ordered://undecodable")
+	require.NoError(t, err)
+	defer topic.Shutdown(ctx)
+
+	writer, err := event.NewWriter(ctx, "ordered://undecodable")
+	require.NoError(t, err)
+	defer writer.Close()
+
+	handler, err := kollect.NewEventHandler(ctx, "ordered://undecodable", kollect.WithContinueOnError())
+	require.NoError(t, err)
+
+	handler.OnResourceDeleted(func(ctx context.Context, clusterID, resourceUID string) error {
+		cancel()
+		return nil
+	})
+
+	require.NoError(t, topic.Send(ctx, &pubsub.Message{Body: []byte("not an event")}))
+	require.NoError(t, writer.Write(ctx, event.New(&resource.ResourceDeletedEvent{
+		Uid:       "test",
+		ClusterId: "test",
+	})))
+
+	// Messages that cannot be decoded should be skipped, rather than stopping or crashing the handler.
+	require.NoError(t, handler.Handle(ctx))
+}
+
+func TestEventHandler_HandleFailures(t *testing.T) {
+	t.Parallel()
+
+	var deadLetter kollect.DeadLetter
+
+	tt := []struct {
+		Name string
+		// Returns the options for the EventHandler, deadLetter is invoked for any dead lettered messages.
+		Options           func(deadLetter kollect.DeadLetterHandler) []kollect.Option
+		FailedAttempts    int
+		ExpectedAttempts  int
+		ExpectsError      bool
+		ExpectsDeadLetter bool
+	}{
+		{
+			Name:             "It should return an error if the handler fails",
+			FailedAttempts:   1,
+			ExpectedAttempts: 1,
+			ExpectsError:     true,
+		},
+		{
+			Name: "It should retry a failed handler",
+			Options: func(kollect.DeadLetterHandler) []kollect.Option {
+				return []kollect.Option{kollect.WithRetry(3, time.Millisecond)}
+			},
+			FailedAttempts:   2,
+			ExpectedAttempts: 3,
+		},
+		{
+			Name: "It should dead letter events once all attempts are exhausted",
+			Options: func(deadLetter kollect.DeadLetterHandler) []kollect.Option {
+				return []kollect.Option{
+					kollect.WithRetry(2, time.Millisecond),
+					kollect.WithDeadLetterHandler(deadLetter),
+				}
+			},
+			FailedAttempts:    5,
+			ExpectedAttempts:  2,
+			ExpectsDeadLetter: true,
+		},
+		{
+			Name: "It should continue handling events on error",
+			Options: func(kollect.DeadLetterHandler) []kollect.Option {
+				return []kollect.Option{kollect.WithContinueOnError()}
+			},
+			FailedAttempts:   1,
+			ExpectedAttempts: 2,
+		},
+	}
+
+	for i, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			url := fmt.Sprintf("mem://failures-%d", i)
+			writer, err := event.NewWriter(ctx, url)
+			require.NoError(t, err)
+			defer writer.Close()
+
+			var opts []kollect.Option
+			if tc.Options != nil {
+				opts = tc.Options(func(ctx context.Context, dl kollect.DeadLetter) error {
+					defer cancel()
+					deadLetter = dl
+					return nil
+				})
+			}
+
+			handler, err := kollect.NewEventHandler(ctx, url, opts...)
+			require.NoError(t, err)
+
+			evt := event.New(&resource.ResourceDeletedEvent{Uid: "test", ClusterId: "test"})
+			require.NoError(t, writer.Write(ctx, evt))
+
+			attempts := 0
 			handler.OnResourceDeleted(func(ctx context.Context, clusterID, resourceUID string) error {
-				cancel()
+				attempts++
+				if attempts <= tc.FailedAttempts {
+					return errors.New("failed")
+				}
 
-				assert.EqualValues(t, tc.ExpectedClusterID, clusterID)
-				assert.EqualValues(t, tc.ExpectedResource.GetUID(), resourceUID)
+				cancel()
 				return nil
 			})
 
 			err = handler.Handle(ctx)
+			assert.Equal(t, tc.ExpectedAttempts, attempts)
 			if tc.ExpectsError {
 				assert.Error(t, err)
-				assert.NotEqual(t, context.Canceled, err)
 				return
 			}
 
-			assert.NoError(t, err)
+			require.NoError(t, err)
+			if tc.ExpectsDeadLetter {
+				assert.Equal(t, evt.ID, deadLetter.EventID)
+				assert.Equal(t, tc.ExpectedAttempts, deadLetter.Attempts)
+				assert.NotEmpty(t, deadLetter.Body)
+				assert.Error(t, deadLetter.Err)
+			}
 		})
 	}
 }
 
+func TestEventHandler_HandleDeadLetterURL(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	writer, err := event.NewWriter(ctx, "mem://dead-letter-source")
+	require.NoError(t, err)
+	defer writer.Close()
+
+	// In-memory subscriptions can only be opened for existing topics. The topic is shared with the handler, which
+	// is responsible for shutting it down.
+	_, err = pubsub.OpenTopic(ctx, "mem://dead-letter")
+	require.NoError(t, err)
+
+	subscription, err := pubsub.OpenSubscription(ctx, "mem://dead-letter")
+	require.NoError(t, err)
+	defer subscription.Shutdown(ctx)
+
+	handler, err := kollect.NewEventHandler(ctx, "mem://dead-letter-source", kollect.WithDeadLetterURL("mem://dead-letter"))
+	require.NoError(t, err)
+
+	handler.OnResourceDeleted(func(ctx context.Context, clusterID, resourceUID string) error {
+		return errors.New("failed")
+	})
+
+	require.NoError(t, writer.Write(ctx, event.New(&resource.ResourceDeletedEvent{Uid: "test", ClusterId: "test"})))
+
+	go func() {
+		defer cancel()
+
+		msg, err := subscription.Receive(ctx)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		msg.Ack()
+		assert.NotEmpty(t, msg.Body)
+		assert.Equal(t, "1", msg.Metadata["dead-letter-attempts"])
+		assert.Contains(t, msg.Metadata["dead-letter-error"], "failed")
+	}()
+
+	assert.NoError(t, handler.Handle(ctx))
+}
+
+func assertMetadata(t *testing.T, ctx context.Context, expected event.Event) {
+	t.Helper()
+
+	md, ok := kollect.MetadataFromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, expected.ID, md.ID)
+	assert.True(t, expected.Timestamp.Equal(md.Timestamp))
+	assert.True(t, expected.AppliesAt.Equal(md.AppliesAt))
+}
+
 func mustMarshal(t *testing.T, obj *unstructured.Unstructured) []byte {
 	t.Helper()
 
@@ -0,0 +1,38 @@
+package kollect
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"k8s.io/klog/v2"
+
+	"github.com/davidsbond/kollect/internal/event"
+)
+
+// The name of the logger used by the EventHandler.
+const loggerName = "kollect"
+
+// WithLogger returns an Option that sets the logr.Logger used by the EventHandler, allowing its logs to be written
+// using any logr implementation. The logger is also available to handlers and Middleware using logr.FromContext,
+// with values describing the event being handled. Defaults to the logger within the context passed to Handle or
+// HandleBatch, or klog if there is none.
+func WithLogger(logger logr.Logger) Option {
+	return func(eh *EventHandler) {
+		eh.logger = &logger
+	}
+}
+
+// contextWithLogger returns a context containing the EventHandler's logger.
+func (eh *EventHandler) contextWithLogger(ctx context.Context) context.Context {
+	logger := klog.FromContext(ctx)
+	if eh.logger != nil {
+		logger = *eh.logger
+	}
+
+	return klog.NewContext(ctx, klog.LoggerWithName(logger, loggerName))
+}
+
+// contextWithEventLogger returns a context whose logger describes the event being handled.
+func contextWithEventLogger(ctx context.Context, evt event.Event) context.Context {
+	return klog.NewContext(ctx, klog.LoggerWithValues(klog.FromContext(ctx), "event", evt.ID, "type", evt.Type()))
+}
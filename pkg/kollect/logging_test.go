@@ -0,0 +1,83 @@
+package kollect_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/davidsbond/kollect/internal/event"
+	"github.com/davidsbond/kollect/pkg/kollect"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+func TestEventHandler_HandleLogger(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var (
+		mux     sync.Mutex
+		entries []string
+	)
+
+	logger := funcr.New(func(prefix, args string) {
+		mux.Lock()
+		defer mux.Unlock()
+		entries = append(entries, prefix+" "+args)
+	}, funcr.Options{Verbosity: 2})
+
+	writer, err := event.NewWriter(ctx, "mem://logger")
+	require.NoError(t, err)
+	defer writer.Close()
+
+	handler, err := kollect.NewEventHandler(ctx, "mem://logger",
+		kollect.WithLogger(logger),
+		kollect.WithMiddleware(kollect.Logging()),
+		kollect.WithContinueOnError(),
+	)
+	require.NoError(t, err)
+
+	evt := event.New(&resource.ResourceDeletedEvent{
+		Uid:       "test",
+		ClusterId: "test",
+	})
+
+	handler.OnResourceDeleted(func(ctx context.Context, clusterID, resourceUID string) error {
+		// Handlers should be able to log using the EventHandler's logger.
+		logr.FromContextOrDiscard(ctx).Info("handling")
+		return errors.New("failed")
+	})
+
+	require.NoError(t, writer.Write(ctx, evt))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- handler.Handle(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		mux.Lock()
+		defer mux.Unlock()
+		return len(entries) >= 3
+	}, time.Second*10, time.Millisecond*10)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	// Failed events are nacked, so may be redelivered before the handler stops.
+	require.GreaterOrEqual(t, len(entries), 3)
+	assert.Contains(t, entries[0], `kollect "level"=0 "msg"="handling" "event"="`+evt.ID+`" "type"="deleted"`)
+	assert.Contains(t, entries[1], `kollect "msg"="Failed to handle event" "error"="failed" "event"="`+evt.ID+`" "type"="deleted"`)
+	assert.Contains(t, entries[2], `kollect/event "msg"="Continuing after failure"`)
+}
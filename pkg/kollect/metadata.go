@@ -0,0 +1,50 @@
+package kollect
+
+import (
+	"context"
+	"time"
+
+	"github.com/davidsbond/kollect/internal/event"
+)
+
+type (
+	// The Metadata type contains information on the event being handled that is not part of the resource itself.
+	Metadata struct {
+		// The unique identifier of the event.
+		ID string
+		// The type of the event, see the EventType constants for possible values.
+		Type string
+		// The key of the event, used by some event buses for partitioning.
+		Key string
+		// The time the event was created.
+		Timestamp time.Time
+		// The time the change in the resource occurred.
+		AppliesAt time.Time
+		// Additional information on the resource, such as its group, version, kind, namespace, name and labels.
+		Attributes map[string]string
+	}
+
+	metadataKey struct{}
+)
+
+// MetadataFromContext returns the Metadata of the event being handled. It can be used within any of the handler
+// functions registered with an EventHandler. Returns false if the context does not belong to an event.
+func MetadataFromContext(ctx context.Context) (Metadata, bool) {
+	md, ok := ctx.Value(metadataKey{}).(Metadata)
+	return md, ok
+}
+
+func contextWithMetadata(ctx context.Context, evt event.Event) context.Context {
+	return context.WithValue(ctx, metadataKey{}, newMetadata(evt))
+}
+
+func newMetadata(evt event.Event) Metadata {
+	return Metadata{
+		ID:         evt.ID,
+		Type:       evt.Type(),
+		Key:        evt.Key,
+		Timestamp:  evt.Timestamp,
+		AppliesAt:  evt.AppliesAt,
+		Attributes: evt.Attributes,
+	}
+}
@@ -0,0 +1,174 @@
+package kollect
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/davidsbond/kollect/internal/event"
+	"github.com/davidsbond/kollect/internal/metrics"
+)
+
+const subsystem = "consumer"
+
+// The consumerMetrics type contains the prometheus metrics recorded by an EventHandler.
+type consumerMetrics struct {
+	duplicatesSkipped *prometheus.CounterVec
+	staleEvents       *prometheus.CounterVec
+	eventsFiltered    *prometheus.CounterVec
+	eventLag          *prometheus.HistogramVec
+	eventAge          *prometheus.HistogramVec
+	handlerDuration   *prometheus.HistogramVec
+	batchDuration     prometheus.Histogram
+	handlerErrors     *prometheus.CounterVec
+	eventsNacked      *prometheus.CounterVec
+	inFlight          *prometheus.GaugeVec
+}
+
+// latencyBuckets are used for histograms measuring the time between a change occurring and it being handled, which
+// can range from milliseconds to hours when a consumer is behind.
+var latencyBuckets = prometheus.ExponentialBuckets(0.01, 4, 10)
+
+// WithRegisterer returns an Option that sets the prometheus.Registerer the EventHandler's metrics are registered
+// with, including those of its connection to the event bus. Multiple EventHandlers can share a Registerer, in which
+// case they share metrics. By default, metrics are not registered.
+func WithRegisterer(registerer prometheus.Registerer) Option {
+	return func(eh *EventHandler) {
+		eh.metricsConfig.Registerer = registerer
+	}
+}
+
+// WithMetricsNamespace returns an Option that sets the namespace the names of the EventHandler's metrics are
+// prefixed with. Defaults to "kollect".
+func WithMetricsNamespace(namespace string) Option {
+	return func(eh *EventHandler) {
+		eh.metricsConfig.Namespace = namespace
+	}
+}
+
+// WithMetricsLabels returns an Option that adds the given labels to all of the EventHandler's metrics. This allows
+// multiple EventHandlers to register metrics with the same Registerer without sharing them.
+func WithMetricsLabels(labels prometheus.Labels) Option {
+	return func(eh *EventHandler) {
+		eh.metricsConfig.ConstLabels = labels
+	}
+}
+
+// WithMetricsNamespaceLabel returns an Option that labels the metrics describing events read from the event bus by
+// the namespace of the resource. This can greatly increase the number of series for clusters with many namespaces.
+func WithMetricsNamespaceLabel() Option {
+	return func(eh *EventHandler) {
+		eh.metricsConfig.NamespaceLabel = true
+	}
+}
+
+// WithLegacyMetrics returns an Option that also records the deprecated kollect_events_read_total and
+// kollect_events_ignored_total metrics. These are labelled by event key so create a series for every resource, and
+// should only be used while migrating to kollect_events_consumed_total and kollect_events_skipped_total.
+func WithLegacyMetrics() Option {
+	return func(eh *EventHandler) {
+		eh.metricsConfig.Legacy = true
+	}
+}
+
+// newMetrics creates the metrics recorded by an EventHandler and registers them as described by the config. Metrics
+// that are already registered are reused.
+func newMetrics(config metrics.Config) (*consumerMetrics, error) {
+	var (
+		m   consumerMetrics
+		err error
+	)
+
+	m.duplicatesSkipped, err = config.NewCounterVec(subsystem, "duplicates_skipped_total",
+		"Total number of duplicate events skipped", []string{"type"})
+	if err != nil {
+		return nil, err
+	}
+
+	m.staleEvents, err = config.NewCounterVec(subsystem, "stale_total",
+		"Total number of events older than an event already handled for the same resource", []string{"type"})
+	if err != nil {
+		return nil, err
+	}
+
+	m.eventsFiltered, err = config.NewCounterVec(subsystem, "filtered_total",
+		"Total number of events that did not match the configured filters", []string{"type"})
+	if err != nil {
+		return nil, err
+	}
+
+	m.eventLag, err = config.NewHistogramVec(subsystem, "lag_seconds",
+		"Time between a change occurring in a cluster and its event being handled successfully", latencyBuckets, []string{"type"})
+	if err != nil {
+		return nil, err
+	}
+
+	m.eventAge, err = config.NewHistogramVec(subsystem, "age_seconds",
+		"Time between an event being published and it being handled successfully", latencyBuckets, []string{"type"})
+	if err != nil {
+		return nil, err
+	}
+
+	m.handlerDuration, err = config.NewHistogramVec(subsystem, "handler_duration_seconds",
+		"Time taken to invoke the handlers registered for an event", prometheus.DefBuckets, []string{"type"})
+	if err != nil {
+		return nil, err
+	}
+
+	m.batchDuration, err = config.NewHistogram(subsystem, "batch_duration_seconds",
+		"Time taken to invoke the handler for a batch of events", prometheus.DefBuckets)
+	if err != nil {
+		return nil, err
+	}
+
+	m.handlerErrors, err = config.NewCounterVec(subsystem, "handler_errors_total",
+		"Total number of times a registered handler returned an error", []string{"type"})
+	if err != nil {
+		return nil, err
+	}
+
+	m.eventsNacked, err = config.NewCounterVec(subsystem, "nacked_total",
+		"Total number of events negatively acknowledged so that they may be redelivered", []string{"type"})
+	if err != nil {
+		return nil, err
+	}
+
+	m.inFlight, err = config.NewGaugeVec(subsystem, "in_flight",
+		"Number of events currently being handled", []string{"type"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// observeLatency records the time since the change described by the event occurred, and since the event was
+// published. It is called once an event has been handled successfully, so is recorded once per event.
+func (m *consumerMetrics) observeLatency(evt event.Event) {
+	now := time.Now()
+	if !evt.AppliesAt.IsZero() {
+		m.eventLag.WithLabelValues(evt.Type()).Observe(now.Sub(evt.AppliesAt).Seconds())
+	}
+
+	if !evt.Timestamp.IsZero() {
+		m.eventAge.WithLabelValues(evt.Type()).Observe(now.Sub(evt.Timestamp).Seconds())
+	}
+}
+
+// nacked records a nacked event. Events that could not be decoded have a type of "unknown".
+func (m *consumerMetrics) nacked(evt event.Event) {
+	m.eventsNacked.WithLabelValues(evt.Type()).Inc()
+}
+
+// filtered records an event that did not match the filters. Events whose payload does not describe a change to a
+// resource, such as those that have not yet been fetched using their claim check, have a type of "unknown".
+func (m *consumerMetrics) filtered(evt event.Event) {
+	typ := evt.Type()
+	switch typ {
+	case EventTypeCreated, EventTypeUpdated, EventTypeDeleted:
+	default:
+		typ = "unknown"
+	}
+
+	m.eventsFiltered.WithLabelValues(typ).Inc()
+}
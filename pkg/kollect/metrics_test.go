@@ -0,0 +1,132 @@
+package kollect_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/davidsbond/kollect/internal/event"
+	"github.com/davidsbond/kollect/pkg/kollect"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+func TestEventHandler_HandleMetrics(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	writer, err := event.NewWriter(ctx, "mem://metrics")
+	require.NoError(t, err)
+	defer writer.Close()
+
+	registry := prometheus.NewRegistry()
+	handler, err := kollect.NewEventHandler(ctx, "mem://metrics",
+		kollect.WithRegisterer(registry),
+		kollect.WithMetricsLabels(prometheus.Labels{"consumer": "test"}),
+		kollect.WithRetry(2, time.Millisecond),
+		kollect.WithContinueOnError(),
+	)
+	require.NoError(t, err)
+
+	// Handlers sharing a registry should share metrics unless they have different labels.
+	_, err = kollect.NewEventHandler(ctx, "mem://metrics",
+		kollect.WithRegisterer(registry),
+		kollect.WithMetricsLabels(prometheus.Labels{"consumer": "test"}),
+	)
+	require.NoError(t, err)
+
+	_, err = kollect.NewEventHandler(ctx, "mem://metrics",
+		kollect.WithRegisterer(registry),
+		kollect.WithMetricsLabels(prometheus.Labels{"consumer": "other"}),
+	)
+	require.NoError(t, err)
+
+	// The created event succeeds on its second attempt, the deleted event always fails so is nacked.
+	var attempts int
+	handler.OnResourceCreated(func(ctx context.Context, clusterID string, obj *unstructured.Unstructured) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("failed")
+		}
+
+		return nil
+	})
+
+	handler.OnResourceDeleted(func(ctx context.Context, clusterID, resourceUID string) error {
+		return errors.New("failed")
+	})
+
+	require.NoError(t, writer.Write(ctx, event.New(&resource.ResourceCreatedEvent{
+		Uid:       "test",
+		Resource:  mustMarshal(t, object("v1", "Pod", "default", "test", nil)),
+		ClusterId: "test",
+	})))
+
+	require.NoError(t, writer.Write(ctx, event.New(&resource.ResourceDeletedEvent{
+		Uid:       "other",
+		ClusterId: "test",
+	})))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- handler.Handle(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return gather(t, registry, "kollect_consumer_nacked_total", kollect.EventTypeDeleted) >= 1 &&
+			gather(t, registry, "kollect_consumer_lag_seconds", kollect.EventTypeCreated) == 1
+	}, time.Second*10, time.Millisecond*10)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	assert.EqualValues(t, 1, gather(t, registry, "kollect_consumer_handler_errors_total", kollect.EventTypeCreated))
+	assert.EqualValues(t, 2, gather(t, registry, "kollect_consumer_handler_duration_seconds", kollect.EventTypeCreated))
+	assert.EqualValues(t, 1, gather(t, registry, "kollect_consumer_age_seconds", kollect.EventTypeCreated))
+	assert.EqualValues(t, 0, gather(t, registry, "kollect_consumer_lag_seconds", kollect.EventTypeDeleted))
+	assert.EqualValues(t, 0, gather(t, registry, "kollect_consumer_in_flight", kollect.EventTypeCreated))
+
+	// Metrics of the connection to the event bus should be registered with the same registry.
+	assert.EqualValues(t, 1, gather(t, registry, "kollect_events_retried_total", "kollect.resource.event.v1.ResourceCreatedEvent"))
+}
+
+// gather returns the value of a counter or gauge, or the sample count of a histogram, with the given name and type
+// label from the registry.
+func gather(t *testing.T, registry *prometheus.Registry, name, typ string) float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() != "type" || label.GetValue() != typ {
+					continue
+				}
+
+				switch {
+				case metric.GetCounter() != nil:
+					return metric.GetCounter().GetValue()
+				case metric.GetGauge() != nil:
+					return metric.GetGauge().GetValue()
+				case metric.GetHistogram() != nil:
+					return float64(metric.GetHistogram().GetSampleCount())
+				}
+			}
+		}
+	}
+
+	return 0
+}
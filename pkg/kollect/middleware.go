@@ -0,0 +1,96 @@
+package kollect
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/davidsbond/kollect/internal/event"
+)
+
+type (
+	// The HandlerFunc type is a function that invokes all handlers registered for an event. Details of the event being
+	// handled are available via MetadataFromContext.
+	HandlerFunc func(ctx context.Context) error
+
+	// The Middleware type is a function that wraps a HandlerFunc, allowing behaviour to be added before and after the
+	// handlers registered for an event are invoked.
+	Middleware func(next HandlerFunc) HandlerFunc
+)
+
+// WithMiddleware returns an Option that wraps the invocation of registered handlers with the given Middleware. The
+// first Middleware given is the outermost. Middleware is only invoked for events that are not filtered, skipped as
+// duplicates or considered stale. Middleware cannot be used with HandleBatch.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(eh *EventHandler) {
+		eh.middleware = append(eh.middleware, mw...)
+	}
+}
+
+// Recover returns a Middleware that converts panics within handlers into errors.
+func Recover() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("recovered from panic: %v", r)
+				}
+			}()
+
+			return next(ctx)
+		}
+	}
+}
+
+// Timeout returns a Middleware that cancels the context passed to handlers after the given duration.
+func Timeout(d time.Duration) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			return next(ctx)
+		}
+	}
+}
+
+// Logging returns a Middleware that logs the outcome of handling each event using the EventHandler's logger, see
+// WithLogger. Successfully handled events are logged at verbosity level 2.
+func Logging() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context) error {
+			logger := klog.FromContext(ctx)
+			start := time.Now()
+
+			err := next(ctx)
+			if err != nil {
+				logger.Error(err, "Failed to handle event", "duration", time.Since(start))
+				return err
+			}
+
+			logger.V(2).Info("Handled event", "duration", time.Since(start))
+			return nil
+		}
+	}
+}
+
+// chain returns an event.Handler that invokes next wrapped in the given Middleware.
+func chain(next event.Handler, mw []Middleware) event.Handler {
+	if len(mw) == 0 {
+		return next
+	}
+
+	return func(ctx context.Context, evt event.Event) error {
+		var fn HandlerFunc = func(ctx context.Context) error {
+			return next(ctx, evt)
+		}
+
+		for i := len(mw) - 1; i >= 0; i-- {
+			fn = mw[i](fn)
+		}
+
+		return fn(ctx)
+	}
+}
@@ -0,0 +1,160 @@
+package kollect_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/davidsbond/kollect/internal/event"
+	"github.com/davidsbond/kollect/pkg/kollect"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+func TestEventHandler_HandleMiddleware(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var (
+		mux   sync.Mutex
+		calls []string
+	)
+
+	record := func(name string) {
+		mux.Lock()
+		defer mux.Unlock()
+		calls = append(calls, name)
+	}
+
+	named := func(name string) kollect.Middleware {
+		return func(next kollect.HandlerFunc) kollect.HandlerFunc {
+			return func(ctx context.Context) error {
+				md, ok := kollect.MetadataFromContext(ctx)
+				require.True(t, ok)
+				assert.Equal(t, kollect.EventTypeCreated, md.Type)
+
+				record(name + " before")
+				err := next(ctx)
+				record(name + " after")
+				return err
+			}
+		}
+	}
+
+	writer, err := event.NewWriter(ctx, "mem://middleware")
+	require.NoError(t, err)
+	defer writer.Close()
+
+	handler, err := kollect.NewEventHandler(ctx, "mem://middleware",
+		kollect.WithMiddleware(named("outer"), named("inner")),
+		kollect.WithMiddleware(kollect.Recover(), kollect.Timeout(time.Second), kollect.Logging()),
+	)
+	require.NoError(t, err)
+
+	handler.OnResourceCreated(func(ctx context.Context, clusterID string, obj *unstructured.Unstructured) error {
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+
+		record("first handler")
+		return nil
+	})
+
+	handler.OnResourceCreated(func(ctx context.Context, clusterID string, obj *unstructured.Unstructured) error {
+		record("second handler")
+		cancel()
+		return nil
+	})
+
+	require.NoError(t, writer.Write(ctx, event.New(&resource.ResourceCreatedEvent{
+		Uid:       "test",
+		Resource:  mustMarshal(t, object("v1", "Pod", "default", "test", nil)),
+		ClusterId: "test",
+	})))
+
+	require.NoError(t, handler.Handle(ctx))
+	assert.EqualValues(t, []string{
+		"outer before",
+		"inner before",
+		"first handler",
+		"second handler",
+		"inner after",
+		"outer after",
+	}, calls)
+}
+
+func TestEventHandler_HandleMultipleFailures(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	writer, err := event.NewWriter(ctx, "mem://middleware-failures")
+	require.NoError(t, err)
+	defer writer.Close()
+
+	var (
+		mux         sync.Mutex
+		deadLetters []kollect.DeadLetter
+		invoked     int
+	)
+
+	handler, err := kollect.NewEventHandler(ctx, "mem://middleware-failures",
+		kollect.WithMiddleware(kollect.Recover()),
+		kollect.WithDeadLetterHandler(func(ctx context.Context, dl kollect.DeadLetter) error {
+			mux.Lock()
+			defer mux.Unlock()
+
+			deadLetters = append(deadLetters, dl)
+			if len(deadLetters) == 2 {
+				cancel()
+			}
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+
+	// A panic in the first handler should be recovered and prevent the remaining handlers from being invoked.
+	handler.OnResourceCreated(func(ctx context.Context, clusterID string, obj *unstructured.Unstructured) error {
+		panic("boom")
+	})
+
+	handler.OnResourceCreated(func(ctx context.Context, clusterID string, obj *unstructured.Unstructured) error {
+		invoked++
+		return nil
+	})
+
+	handler.OnResourceDeleted(func(ctx context.Context, clusterID, resourceUID string) error {
+		return errors.New("failed")
+	})
+
+	handler.OnResourceDeleted(func(ctx context.Context, clusterID, resourceUID string) error {
+		invoked++
+		return nil
+	})
+
+	require.NoError(t, writer.Write(ctx, event.New(&resource.ResourceCreatedEvent{
+		Uid:       "test",
+		Resource:  mustMarshal(t, object("v1", "Pod", "default", "test", nil)),
+		ClusterId: "test",
+	})))
+
+	require.NoError(t, writer.Write(ctx, event.New(&resource.ResourceDeletedEvent{
+		Uid:       "test",
+		ClusterId: "test",
+	})))
+
+	require.NoError(t, handler.Handle(ctx))
+	assert.Zero(t, invoked)
+	require.Len(t, deadLetters, 2)
+
+	errs := deadLetters[0].Err.Error() + "\n" + deadLetters[1].Err.Error()
+	assert.Contains(t, errs, "recovered from panic: boom")
+	assert.Contains(t, errs, ": failed")
+}
@@ -0,0 +1,130 @@
+package kollect_test
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"gocloud.dev/gcerrors"
+	"gocloud.dev/pubsub"
+	"gocloud.dev/pubsub/driver"
+)
+
+// The orderedQueue type is an in-memory event bus that, unlike mempubsub, delivers messages in the order they were
+// sent. It is registered under the "ordered" URL scheme, topics and subscriptions with the same host share a queue.
+// Messages are delivered once and cannot be nacked.
+type orderedQueue struct {
+	mux   sync.Mutex
+	msgs  []*driver.Message
+	ackID int
+}
+
+var (
+	orderedQueues   = make(map[string]*orderedQueue)
+	orderedQueueMux sync.Mutex
+)
+
+func init() {
+	pubsub.DefaultURLMux().RegisterTopic("ordered", orderedOpener{})
+	pubsub.DefaultURLMux().RegisterSubscription("ordered", orderedOpener{})
+}
+
+type orderedOpener struct{}
+
+func (orderedOpener) OpenTopicURL(_ context.Context, u *url.URL) (*pubsub.Topic, error) {
+	return pubsub.NewTopic(orderedTopic{queue: openOrderedQueue(u)}, nil), nil
+}
+
+func (orderedOpener) OpenSubscriptionURL(_ context.Context, u *url.URL) (*pubsub.Subscription, error) {
+	return pubsub.NewSubscription(orderedSubscription{queue: openOrderedQueue(u)}, nil, nil), nil
+}
+
+func openOrderedQueue(u *url.URL) *orderedQueue {
+	orderedQueueMux.Lock()
+	defer orderedQueueMux.Unlock()
+
+	queue, ok := orderedQueues[u.Host]
+	if !ok {
+		queue = &orderedQueue{}
+		orderedQueues[u.Host] = queue
+	}
+
+	return queue
+}
+
+type orderedTopic struct {
+	queue *orderedQueue
+}
+
+func (t orderedTopic) SendBatch(_ context.Context, msgs []*driver.Message) error {
+	t.queue.mux.Lock()
+	defer t.queue.mux.Unlock()
+
+	asFunc := func(interface{}) bool { return false }
+	for _, msg := range msgs {
+		if msg.BeforeSend != nil {
+			if err := msg.BeforeSend(asFunc); err != nil {
+				return err
+			}
+		}
+
+		t.queue.ackID++
+		msg.AckID = t.queue.ackID
+		msg.LoggableID = fmt.Sprintf("msg #%d", t.queue.ackID)
+		msg.AsFunc = asFunc
+		t.queue.msgs = append(t.queue.msgs, msg)
+
+		if msg.AfterSend != nil {
+			if err := msg.AfterSend(asFunc); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (orderedTopic) IsRetryable(error) bool             { return false }
+func (orderedTopic) As(interface{}) bool                { return false }
+func (orderedTopic) ErrorAs(error, interface{}) bool    { return false }
+func (orderedTopic) ErrorCode(error) gcerrors.ErrorCode { return gcerrors.Unknown }
+func (orderedTopic) Close() error                       { return nil }
+
+type orderedSubscription struct {
+	queue *orderedQueue
+}
+
+func (s orderedSubscription) ReceiveBatch(ctx context.Context, maxMessages int) ([]*driver.Message, error) {
+	s.queue.mux.Lock()
+	n := len(s.queue.msgs)
+	if n > maxMessages {
+		n = maxMessages
+	}
+
+	msgs := s.queue.msgs[:n:n]
+	s.queue.msgs = s.queue.msgs[n:]
+	s.queue.mux.Unlock()
+
+	if len(msgs) > 0 {
+		return msgs, nil
+	}
+
+	// Wait before returning no messages, as the subscription will immediately call ReceiveBatch again.
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(time.Millisecond * 10):
+		return nil, nil
+	}
+}
+
+func (orderedSubscription) SendAcks(context.Context, []driver.AckID) error  { return nil }
+func (orderedSubscription) CanNack() bool                                   { return false }
+func (orderedSubscription) SendNacks(context.Context, []driver.AckID) error { return nil }
+func (orderedSubscription) IsRetryable(error) bool                          { return false }
+func (orderedSubscription) As(interface{}) bool                             { return false }
+func (orderedSubscription) ErrorAs(error, interface{}) bool                 { return false }
+func (orderedSubscription) ErrorCode(error) gcerrors.ErrorCode              { return gcerrors.Unknown }
+func (orderedSubscription) Close() error                                    { return nil }
@@ -0,0 +1,169 @@
+package kollect
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/cache"
+
+	"github.com/davidsbond/kollect/internal/event"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+type (
+	// The StaleEventHandler type is a function that is invoked when the EventHandler consumes an event that is older
+	// than one already handled for the same resource. Use MetadataFromContext to access the metadata of the stale
+	// event.
+	StaleEventHandler func(ctx context.Context, clusterID, resourceUID string) error
+
+	// The staleGuard type tracks the latest version of each resource that has been handled, so that events older than
+	// it can be identified.
+	staleGuard struct {
+		versions *cache.LRUExpireCache
+		ttl      time.Duration
+	}
+
+	// The appliedVersion type describes the version of a resource that was last handled.
+	appliedVersion struct {
+		// The resource version of the resource, zero if it is not known or is not numeric.
+		resourceVersion uint64
+		// The time the change in the resource occurred.
+		appliesAt time.Time
+		// Whether the resource was deleted.
+		deleted bool
+	}
+)
+
+// WithStaleProtection returns an Option that skips events that are older than an event already handled for the same
+// resource, which can happen when using event buses that do not guarantee ordering. Events are compared using the
+// resource version of the resource they describe, falling back to the time the change occurred when the resource
+// version is not available. A resource is deleted after all of its other changes, so a deletion is never stale unless
+// the resource was already deleted, and any other event for a deleted resource is. The latest version of up to size
+// resources is tracked, each of which is forgotten once the ttl has elapsed. Use OnStaleEvent to handle stale events
+// rather than skipping them.
+func WithStaleProtection(size int, ttl time.Duration) Option {
+	return func(eh *EventHandler) {
+		eh.staleGuard = &staleGuard{
+			versions: cache.NewLRUExpireCache(size),
+			ttl:      ttl,
+		}
+	}
+}
+
+// OnStaleEvent adds a StaleEventHandler implementation to be invoked whenever an event older than one already
+// handled for the same resource is consumed. Requires the WithStaleProtection option. Handlers are invoked in the
+// order they were added, if a handler returns an error the remaining handlers are not invoked.
+func (eh *EventHandler) OnStaleEvent(fn StaleEventHandler) {
+	eh.onStaleEvent = append(eh.onStaleEvent, fn)
+}
+
+// guard returns an event.Handler that invokes next for events that are not stale, and stale for those that are.
+func (s *staleGuard) guard(next, stale event.Handler, m *consumerMetrics) event.Handler {
+	return func(ctx context.Context, evt event.Event) error {
+		key, version, isStale, err := s.check(evt)
+		switch {
+		case err != nil:
+			return err
+		case isStale:
+			m.staleEvents.WithLabelValues(evt.Type()).Inc()
+			return stale(ctx, evt)
+		}
+
+		if err = next(ctx, evt); err != nil {
+			return err
+		}
+
+		s.record(key, version)
+		return nil
+	}
+}
+
+// check returns the key and version of the resource described by the event, and whether the event is older than the
+// latest version handled for the resource. The key is blank for events that do not describe a resource.
+func (s *staleGuard) check(evt event.Event) (string, appliedVersion, bool, error) {
+	key, version, err := eventVersion(evt)
+	if err != nil || key == "" {
+		return key, version, false, err
+	}
+
+	latest, ok := s.versions.Get(key)
+	return key, version, ok && version.olderThan(latest.(appliedVersion)), nil
+}
+
+// record the version as the latest handled for the resource identified by the key.
+func (s *staleGuard) record(key string, version appliedVersion) {
+	if key != "" {
+		s.versions.Add(key, version, s.ttl)
+	}
+}
+
+func (eh *EventHandler) handleStaleEvent(ctx context.Context, evt event.Event) error {
+	clusterID, uid := resourceIdentity(evt)
+	for _, fn := range eh.onStaleEvent {
+		if err := fn(ctx, clusterID, uid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// olderThan returns true if the version describes a change that occurred before the other version. A deletion is
+// always newer than any other change, as the deletion timestamp it applies at is set before finalizers run and may
+// precede their updates. Resource versions are only compared if both are known and neither resource was deleted.
+func (v appliedVersion) olderThan(other appliedVersion) bool {
+	switch {
+	case v.deleted != other.deleted:
+		return other.deleted
+	case v.resourceVersion != 0 && other.resourceVersion != 0 && !v.deleted:
+		return v.resourceVersion < other.resourceVersion
+	default:
+		return v.appliesAt.Before(other.appliesAt)
+	}
+}
+
+// eventVersion returns the cluster and UID of the resource described by the event, along with the version of the
+// resource it describes. Returns a blank key for events that do not describe a resource.
+func eventVersion(evt event.Event) (string, appliedVersion, error) {
+	version := appliedVersion{appliesAt: evt.AppliesAt}
+
+	var obj []byte
+	switch payload := evt.Payload.(type) {
+	case *resource.ResourceCreatedEvent:
+		obj = payload.GetResource()
+	case *resource.ResourceUpdatedEvent:
+		obj = payload.GetNow()
+	case *resource.ResourceDeletedEvent:
+		version.deleted = true
+	default:
+		return "", version, nil
+	}
+
+	clusterID, uid := resourceIdentity(evt)
+	if obj != nil {
+		rv, err := parseResourceVersion(uid, obj)
+		if err != nil {
+			return "", version, err
+		}
+
+		// Resource versions are opaque, but are integers when using etcd. If they cannot be parsed the time the change
+		// occurred is used instead.
+		version.resourceVersion, _ = strconv.ParseUint(rv, 10, 64)
+	}
+
+	return clusterID + "/" + uid, version, nil
+}
+
+func resourceIdentity(evt event.Event) (string, string) {
+	type resourceEvent interface {
+		GetClusterId() string
+		GetUid() string
+	}
+
+	if payload, ok := evt.Payload.(resourceEvent); ok {
+		return payload.GetClusterId(), payload.GetUid()
+	}
+
+	return "", ""
+}
@@ -0,0 +1,177 @@
+package kollect_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/davidsbond/kollect/internal/event"
+	"github.com/davidsbond/kollect/pkg/kollect"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+type staleTestCase struct {
+	Name     string
+	Event    event.Event
+	Expected string
+}
+
+const (
+	handledResult = "handled"
+	staleResult   = "stale"
+)
+
+func TestEventHandler_HandleStaleEvents(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	testStaleEvents(t, "mem://stale", []staleTestCase{
+		{
+			Name:     "It should handle the first event for a resource",
+			Event:    updated(t, "2", now),
+			Expected: handledResult,
+		},
+		{
+			Name:     "It should detect events with an older resource version",
+			Event:    updated(t, "1", now.Add(time.Second)),
+			Expected: staleResult,
+		},
+		{
+			Name:     "It should handle events with a newer resource version",
+			Event:    updated(t, "3", now.Add(time.Second)),
+			Expected: handledResult,
+		},
+		{
+			Name:     "It should handle deletions that occurred after the latest change",
+			Event:    deleted(now.Add(time.Minute)),
+			Expected: handledResult,
+		},
+		{
+			Name:     "It should detect events that occurred before a deletion",
+			Event:    updated(t, "4", now.Add(time.Second*2)),
+			Expected: staleResult,
+		},
+	})
+}
+
+func TestEventHandler_HandleStaleEventsWithFinalizers(t *testing.T) {
+	t.Parallel()
+
+	// Deletions are stamped with the deletion timestamp, which has second precision and is set before any updates
+	// made by finalizers.
+	now := time.Now()
+	deletedAt := now.Truncate(time.Second)
+
+	testStaleEvents(t, "mem://stale-finalizers", []staleTestCase{
+		{
+			Name:     "It should handle the update setting the deletion timestamp",
+			Event:    updated(t, "1", now),
+			Expected: handledResult,
+		},
+		{
+			Name:     "It should handle updates made by finalizers",
+			Event:    updated(t, "2", now.Add(time.Second)),
+			Expected: handledResult,
+		},
+		{
+			Name:     "It should handle the deletion once finalizers have been removed",
+			Event:    deleted(deletedAt),
+			Expected: handledResult,
+		},
+		{
+			Name:     "It should detect updates received after the deletion",
+			Event:    updated(t, "3", now.Add(time.Second*2)),
+			Expected: staleResult,
+		},
+	})
+}
+
+// testStaleEvents writes each event to the topic at the given url, asserting whether it is handled or stale.
+func testStaleEvents(t *testing.T, url string, tt []staleTestCase) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	writer, err := event.NewWriter(ctx, url)
+	require.NoError(t, err)
+	defer writer.Close()
+
+	handler, err := kollect.NewEventHandler(ctx, url, kollect.WithStaleProtection(10, time.Minute))
+	require.NoError(t, err)
+
+	results := make(chan string)
+	handler.OnResourceUpdated(func(ctx context.Context, clusterID string, then, now *unstructured.Unstructured) error {
+		results <- handledResult
+		return nil
+	})
+
+	handler.OnResourceDeleted(func(ctx context.Context, clusterID, resourceUID string) error {
+		results <- handledResult
+		return nil
+	})
+
+	handler.OnStaleEvent(func(ctx context.Context, clusterID, resourceUID string) error {
+		assert.Equal(t, "test", clusterID)
+		assert.Equal(t, "test", resourceUID)
+
+		results <- staleResult
+		return nil
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- handler.Handle(ctx)
+	}()
+
+	// Events are written one at a time, waiting for each to be handled, so that the order they are received in is
+	// known.
+	for _, tc := range tt {
+		require.NoError(t, writer.Write(ctx, tc.Event), tc.Name)
+
+		select {
+		case result := <-results:
+			assert.Equal(t, tc.Expected, result, tc.Name)
+		case <-ctx.Done():
+			require.FailNow(t, "timed out waiting for event", tc.Name)
+		}
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func deleted(appliesAt time.Time) event.Event {
+	return event.New(&resource.ResourceDeletedEvent{
+		Uid:       "test",
+		ClusterId: "test",
+	}, event.WithAppliesAt(appliesAt))
+}
+
+func updated(t *testing.T, resourceVersion string, appliesAt time.Time) event.Event {
+	t.Helper()
+
+	obj := mustMarshal(t, &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":            "example",
+				"namespace":       "namespace",
+				"uid":             "test",
+				"resourceVersion": resourceVersion,
+			},
+		},
+	})
+
+	return event.New(&resource.ResourceUpdatedEvent{
+		Uid:       "test",
+		Then:      obj,
+		Now:       obj,
+		ClusterId: "test",
+	}, event.WithAppliesAt(appliesAt))
+}
@@ -0,0 +1,273 @@
+package kollect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+type (
+	// The Store type maintains an in-memory view of resources across all clusters, built by handling the events
+	// consumed by an EventHandler. It is safe for concurrent use. Objects returned by the Store are shared and must
+	// not be modified.
+	Store struct {
+		indexer cache.Indexer
+
+		listenerMux *sync.RWMutex
+		listeners   []StoreListener
+
+		idle      time.Duration
+		idleMux   *sync.Mutex
+		idleTimer *time.Timer
+		ready     chan struct{}
+		readyOnce *sync.Once
+	}
+
+	// The Resource type describes a resource within a Store.
+	Resource struct {
+		// The cluster the resource belongs to.
+		ClusterID string
+		// The resource itself.
+		Object *unstructured.Unstructured
+	}
+
+	// The StoreChange type describes a change made to a Store.
+	StoreChange struct {
+		// The type of change, one of EventTypeCreated, EventTypeUpdated or EventTypeDeleted.
+		Type string
+		// The resource before the change, nil for created resources.
+		Old *Resource
+		// The resource after the change, nil for deleted resources.
+		New *Resource
+	}
+
+	// The StoreListener type is a function that is invoked whenever a Store is changed.
+	StoreListener func(ctx context.Context, change StoreChange)
+
+	// The StoreOption type is a function that can modify the behaviour of a Store.
+	StoreOption func(s *Store)
+)
+
+// Index names used by the Store.
+const (
+	indexGroupVersionKind = "gvk"
+	indexNamespace        = "namespace"
+	indexCluster          = "cluster"
+)
+
+// NewStore returns a new instance of the Store type. Use Register to populate it using an EventHandler.
+func NewStore(opts ...StoreOption) *Store {
+	s := &Store{
+		indexer: cache.NewIndexer(storeKeyFunc, cache.Indexers{
+			indexGroupVersionKind: func(obj interface{}) ([]string, error) {
+				return []string{obj.(Resource).Object.GroupVersionKind().String()}, nil
+			},
+			indexNamespace: func(obj interface{}) ([]string, error) {
+				return []string{obj.(Resource).Object.GetNamespace()}, nil
+			},
+			indexCluster: func(obj interface{}) ([]string, error) {
+				return []string{obj.(Resource).ClusterID}, nil
+			},
+		}),
+		listenerMux: &sync.RWMutex{},
+		idleMux:     &sync.Mutex{},
+		ready:       make(chan struct{}),
+		readyOnce:   &sync.Once{},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// WithReadyAfterIdle returns a StoreOption that marks the Store as ready once no events have been handled for the
+// given duration, which indicates that it has caught up with the event bus. The duration is measured from the first
+// event handled, so a Store reading from an event bus without any events must be marked ready using MarkReady.
+func WithReadyAfterIdle(idle time.Duration) StoreOption {
+	return func(s *Store) {
+		s.idle = idle
+	}
+}
+
+// Register the Store with the EventHandler, so that it is updated as events are handled.
+func (s *Store) Register(eh *EventHandler) {
+	eh.OnResourceCreated(s.HandleResourceCreated)
+	eh.OnResourceUpdated(s.HandleResourceUpdated)
+	eh.OnResourceDeleted(s.HandleResourceDeleted)
+}
+
+// HandleResourceCreated adds the resource to the Store. It implements the ResourceCreatedHandler type.
+func (s *Store) HandleResourceCreated(ctx context.Context, clusterID string, obj *unstructured.Unstructured) error {
+	return s.upsert(ctx, Resource{ClusterID: clusterID, Object: obj})
+}
+
+// HandleResourceUpdated updates the resource within the Store, adding it if it does not exist. It implements the
+// ResourceUpdatedHandler type.
+func (s *Store) HandleResourceUpdated(ctx context.Context, clusterID string, _, now *unstructured.Unstructured) error {
+	return s.upsert(ctx, Resource{ClusterID: clusterID, Object: now})
+}
+
+// HandleResourceDeleted removes the resource from the Store. It implements the ResourceDeletedHandler type.
+func (s *Store) HandleResourceDeleted(ctx context.Context, clusterID, resourceUID string) error {
+	defer s.touch()
+
+	old, ok := s.Get(clusterID, resourceUID)
+	if !ok {
+		return nil
+	}
+
+	if err := s.indexer.Delete(old); err != nil {
+		return fmt.Errorf("failed to delete resource %s: %w", resourceUID, err)
+	}
+
+	s.notify(ctx, StoreChange{Type: EventTypeDeleted, Old: &old})
+	return nil
+}
+
+// OnChange sets up a StoreListener to be invoked whenever a resource within the Store is created, updated or
+// deleted. Listeners are invoked synchronously, in the order they were added.
+func (s *Store) OnChange(fn StoreListener) {
+	s.listenerMux.Lock()
+	defer s.listenerMux.Unlock()
+
+	s.listeners = append(s.listeners, fn)
+}
+
+// Get the resource with the given UID within the given cluster. Returns false if the resource does not exist.
+func (s *Store) Get(clusterID, resourceUID string) (Resource, bool) {
+	obj, ok, err := s.indexer.GetByKey(storeKey(clusterID, resourceUID))
+	if err != nil || !ok {
+		return Resource{}, false
+	}
+
+	return obj.(Resource), true
+}
+
+// List all resources within the Store.
+func (s *Store) List() []Resource {
+	return toResources(s.indexer.List())
+}
+
+// ByGroupVersionKind returns all resources within the Store of the given group, version and kind.
+func (s *Store) ByGroupVersionKind(gvk schema.GroupVersionKind) []Resource {
+	return s.byIndex(indexGroupVersionKind, gvk.String())
+}
+
+// ByNamespace returns all resources within the Store in the given namespace. Cluster-scoped resources can be
+// listed using a blank namespace.
+func (s *Store) ByNamespace(namespace string) []Resource {
+	return s.byIndex(indexNamespace, namespace)
+}
+
+// ByCluster returns all resources within the Store that belong to the given cluster.
+func (s *Store) ByCluster(clusterID string) []Resource {
+	return s.byIndex(indexCluster, clusterID)
+}
+
+// BySelector returns all resources within the Store whose labels match the given selector.
+func (s *Store) BySelector(selector labels.Selector) []Resource {
+	resources := make([]Resource, 0)
+	for _, resource := range s.List() {
+		if selector.Matches(labels.Set(resource.Object.GetLabels())) {
+			resources = append(resources, resource)
+		}
+	}
+
+	return resources
+}
+
+// MarkReady marks the Store as ready, indicating that it contains the initial state of all clusters.
+func (s *Store) MarkReady() {
+	s.readyOnce.Do(func() {
+		close(s.ready)
+	})
+}
+
+// Ready returns a channel that is closed once the Store is ready, either because MarkReady was called or because
+// no events have been handled for the duration set using WithReadyAfterIdle.
+func (s *Store) Ready() <-chan struct{} {
+	return s.ready
+}
+
+func (s *Store) upsert(ctx context.Context, resource Resource) error {
+	defer s.touch()
+
+	change := StoreChange{Type: EventTypeCreated, New: &resource}
+	if old, ok := s.Get(resource.ClusterID, string(resource.Object.GetUID())); ok {
+		change.Type = EventTypeUpdated
+		change.Old = &old
+	}
+
+	if err := s.indexer.Update(resource); err != nil {
+		return fmt.Errorf("failed to store resource %s: %w", resource.Object.GetUID(), err)
+	}
+
+	s.notify(ctx, change)
+	return nil
+}
+
+func (s *Store) notify(ctx context.Context, change StoreChange) {
+	s.listenerMux.RLock()
+	defer s.listenerMux.RUnlock()
+
+	for _, fn := range s.listeners {
+		fn(ctx, change)
+	}
+}
+
+// touch resets the idle timer if WithReadyAfterIdle is used, starting it when the first event is handled.
+func (s *Store) touch() {
+	if s.idle <= 0 {
+		return
+	}
+
+	s.idleMux.Lock()
+	defer s.idleMux.Unlock()
+
+	if s.idleTimer == nil {
+		s.idleTimer = time.AfterFunc(s.idle, s.MarkReady)
+		return
+	}
+
+	s.idleTimer.Reset(s.idle)
+}
+
+func (s *Store) byIndex(name, value string) []Resource {
+	objs, err := s.indexer.ByIndex(name, value)
+	if err != nil {
+		return nil
+	}
+
+	return toResources(objs)
+}
+
+func toResources(objs []interface{}) []Resource {
+	resources := make([]Resource, len(objs))
+	for i, obj := range objs {
+		resources[i] = obj.(Resource)
+	}
+
+	return resources
+}
+
+func storeKey(clusterID, resourceUID string) string {
+	return clusterID + "/" + resourceUID
+}
+
+func storeKeyFunc(obj interface{}) (string, error) {
+	resource, ok := obj.(Resource)
+	if !ok {
+		return "", errors.New("object is not a Resource")
+	}
+
+	return storeKey(resource.ClusterID, string(resource.Object.GetUID())), nil
+}
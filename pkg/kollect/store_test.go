@@ -0,0 +1,121 @@
+package kollect_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/davidsbond/kollect/internal/event"
+	"github.com/davidsbond/kollect/pkg/kollect"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := kollect.NewStore()
+
+	changes := make([]kollect.StoreChange, 0)
+	store.OnChange(func(ctx context.Context, change kollect.StoreChange) {
+		changes = append(changes, change)
+	})
+
+	deployment := object("apps/v1", "Deployment", "production", "deployment", map[string]string{"app": "example"})
+	pod := object("v1", "Pod", "production", "pod", map[string]string{"app": "example"})
+	node := object("v1", "Node", "", "node", nil)
+
+	require.NoError(t, store.HandleResourceCreated(ctx, "cluster-a", deployment))
+	require.NoError(t, store.HandleResourceCreated(ctx, "cluster-a", pod))
+	require.NoError(t, store.HandleResourceCreated(ctx, "cluster-b", node))
+
+	updated := deployment.DeepCopy()
+	updated.SetLabels(map[string]string{"app": "other"})
+	require.NoError(t, store.HandleResourceUpdated(ctx, "cluster-a", deployment, updated))
+
+	actual, ok := store.Get("cluster-a", "deployment")
+	require.True(t, ok)
+	assert.Equal(t, "other", actual.Object.GetLabels()["app"])
+
+	assert.Len(t, store.List(), 3)
+	assert.Len(t, store.ByCluster("cluster-a"), 2)
+	assert.Len(t, store.ByNamespace("production"), 2)
+	assert.Len(t, store.ByNamespace(""), 1)
+	assert.Len(t, store.ByGroupVersionKind(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}), 1)
+	assert.Len(t, store.BySelector(labels.SelectorFromSet(labels.Set{"app": "example"})), 1)
+
+	require.NoError(t, store.HandleResourceDeleted(ctx, "cluster-a", "pod"))
+	_, ok = store.Get("cluster-a", "pod")
+	assert.False(t, ok)
+
+	// Deleting a resource that is not in the store should not produce a change.
+	require.NoError(t, store.HandleResourceDeleted(ctx, "cluster-a", "unknown"))
+
+	require.Len(t, changes, 5)
+	assert.Equal(t, kollect.EventTypeCreated, changes[0].Type)
+	assert.Equal(t, kollect.EventTypeUpdated, changes[3].Type)
+	assert.Equal(t, "example", changes[3].Old.Object.GetLabels()["app"])
+	assert.Equal(t, "other", changes[3].New.Object.GetLabels()["app"])
+	assert.Equal(t, kollect.EventTypeDeleted, changes[4].Type)
+	assert.Nil(t, changes[4].New)
+}
+
+func TestStore_Register(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	writer, err := event.NewWriter(ctx, "mem://store")
+	require.NoError(t, err)
+	defer writer.Close()
+
+	handler, err := kollect.NewEventHandler(ctx, "mem://store")
+	require.NoError(t, err)
+
+	store := kollect.NewStore(kollect.WithReadyAfterIdle(time.Millisecond * 100))
+	store.Register(handler)
+
+	// The store should not become ready until it has handled events and then been idle.
+	time.Sleep(time.Millisecond * 200)
+	select {
+	case <-store.Ready():
+		assert.Fail(t, "store should not be ready before handling events")
+	default:
+	}
+
+	for _, name := range []string{"first", "second"} {
+		require.NoError(t, writer.Write(ctx, event.New(&resource.ResourceCreatedEvent{
+			Uid:       name,
+			Resource:  mustMarshal(t, object("v1", "Pod", "default", name, nil)),
+			ClusterId: "test",
+		})))
+	}
+
+	go func() {
+		<-store.Ready()
+		cancel()
+	}()
+
+	require.NoError(t, handler.Handle(ctx))
+	assert.Len(t, store.ByCluster("test"), 2)
+}
+
+func object(apiVersion, kind, namespace, name string, set map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetUID(types.UID(name))
+	obj.SetLabels(set)
+
+	return obj
+}
@@ -0,0 +1,29 @@
+package kollect
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/davidsbond/kollect/internal/event"
+)
+
+// WithTracerProvider returns an Option that sets the trace.TracerProvider used to create spans for events read from
+// the event bus and for invocations of registered handlers. Trace context written by the agent is read from message
+// metadata, so handler spans continue the trace of the resource change that produced the event. Defaults to the
+// global trace.TracerProvider.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(eh *EventHandler) {
+		eh.tracerProvider = provider
+	}
+}
+
+// startSpan starts a span for invoking the handlers registered for the event.
+func (eh *EventHandler) startSpan(ctx context.Context, evt event.Event) (context.Context, trace.Span) {
+	return eh.tracer.Start(ctx, "handle "+evt.Type(), trace.WithAttributes(
+		attribute.String("kollect.event.id", evt.ID),
+		attribute.String("kollect.event.type", evt.Type()),
+		attribute.String("kollect.cluster_id", evt.Attributes[event.AttributeClusterID]),
+	))
+}
@@ -0,0 +1,73 @@
+package kollect_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/davidsbond/kollect/internal/event"
+	"github.com/davidsbond/kollect/pkg/kollect"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+func TestEventHandler_HandleTracing(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	writer, err := event.NewWriter(ctx, "mem://tracing", event.WithWriterTracerProvider(provider))
+	require.NoError(t, err)
+	defer writer.Close()
+
+	handler, err := kollect.NewEventHandler(ctx, "mem://tracing",
+		kollect.WithTracerProvider(provider),
+		kollect.WithContinueOnError(),
+	)
+	require.NoError(t, err)
+
+	var actual trace.SpanContext
+	handler.OnResourceDeleted(func(ctx context.Context, clusterID, resourceUID string) error {
+		defer cancel()
+		actual = trace.SpanContextFromContext(ctx)
+		return errors.New("failed")
+	})
+
+	require.NoError(t, writer.Write(ctx, event.New(&resource.ResourceDeletedEvent{
+		Uid:       "test",
+		ClusterId: "test",
+	})))
+
+	require.NoError(t, handler.Handle(ctx))
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	require.Contains(t, spans, "mem://tracing send")
+	require.Contains(t, spans, "mem://tracing process")
+	require.Contains(t, spans, "handle "+kollect.EventTypeDeleted)
+
+	send := spans["mem://tracing send"]
+	process := spans["mem://tracing process"]
+	handle := spans["handle "+kollect.EventTypeDeleted]
+
+	// Handlers are invoked within a span that is a child of the span created by the reader, which continues the
+	// trace of the writer.
+	assert.Equal(t, send.SpanContext().TraceID(), actual.TraceID())
+	assert.Equal(t, handle.SpanContext().SpanID(), actual.SpanID())
+	assert.Equal(t, process.SpanContext().SpanID(), handle.Parent().SpanID())
+	assert.Equal(t, codes.Error, handle.Status().Code)
+}
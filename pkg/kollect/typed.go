@@ -0,0 +1,181 @@
+package kollect
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/davidsbond/kollect/internal/event"
+)
+
+type (
+	// The ObjectCreatedHandler type is a function that is invoked when the EventHandler consumes an event indicating
+	// the creation/discovery of a new resource of a registered type. The object can be asserted to the type it was
+	// registered with.
+	ObjectCreatedHandler func(ctx context.Context, clusterID string, obj runtime.Object) error
+
+	// The ObjectUpdatedHandler type is a function that is invoked when the EventHandler consumes an event indicating
+	// that an existing cluster resource of a registered type has been modified. The objects can be asserted to the type
+	// they were registered with.
+	ObjectUpdatedHandler func(ctx context.Context, clusterID string, then, now runtime.Object) error
+
+	// The ObjectDeletedHandler type is a function that is invoked when the EventHandler consumes an event indicating
+	// that an existing cluster resource of a registered type was deleted.
+	ObjectDeletedHandler func(ctx context.Context, clusterID, resourceUID string) error
+
+	// The typedHandlers type contains the handlers registered for a single group, version and kind.
+	typedHandlers struct {
+		onObjectCreated []ObjectCreatedHandler
+		onObjectUpdated []ObjectUpdatedHandler
+		onObjectDeleted []ObjectDeletedHandler
+	}
+)
+
+// WithScheme returns an Option that sets the scheme used to decode resources into the types registered using
+// OnObjectCreated, OnObjectUpdated and OnObjectDeleted. Custom resource types must be added to the scheme before
+// they can be registered. Defaults to a scheme containing the built-in Kubernetes types.
+func WithScheme(scheme *runtime.Scheme) Option {
+	return func(eh *EventHandler) {
+		eh.scheme = scheme
+	}
+}
+
+// OnObjectCreated adds an ObjectCreatedHandler implementation to be invoked whenever an event that indicates a
+// new resource of the same type as obj is consumed. The type of obj must be registered with the EventHandler's
+// scheme.
+func (eh *EventHandler) OnObjectCreated(obj runtime.Object, fn ObjectCreatedHandler) error {
+	handlers, err := eh.typedHandlers(obj)
+	if err != nil {
+		return err
+	}
+
+	handlers.onObjectCreated = append(handlers.onObjectCreated, fn)
+	return nil
+}
+
+// OnObjectUpdated adds an ObjectUpdatedHandler implementation to be invoked whenever an event that indicates an
+// existing resource of the same type as obj has been modified. The type of obj must be registered with the
+// EventHandler's scheme.
+func (eh *EventHandler) OnObjectUpdated(obj runtime.Object, fn ObjectUpdatedHandler) error {
+	handlers, err := eh.typedHandlers(obj)
+	if err != nil {
+		return err
+	}
+
+	handlers.onObjectUpdated = append(handlers.onObjectUpdated, fn)
+	return nil
+}
+
+// OnObjectDeleted adds an ObjectDeletedHandler implementation to be invoked whenever an event that indicates an
+// existing resource of the same type as obj has been deleted. The type of obj must be registered with the
+// EventHandler's scheme.
+func (eh *EventHandler) OnObjectDeleted(obj runtime.Object, fn ObjectDeletedHandler) error {
+	handlers, err := eh.typedHandlers(obj)
+	if err != nil {
+		return err
+	}
+
+	handlers.onObjectDeleted = append(handlers.onObjectDeleted, fn)
+	return nil
+}
+
+// typedHandlers returns the handlers registered for the group, version and kind of obj, creating them if they do not
+// exist.
+func (eh *EventHandler) typedHandlers(obj runtime.Object) (*typedHandlers, error) {
+	gvks, _, err := eh.scheme.ObjectKinds(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine kind of %T: %w", obj, err)
+	}
+
+	gvk := gvks[0]
+	if _, ok := eh.typed[gvk]; !ok {
+		eh.typed[gvk] = &typedHandlers{}
+	}
+
+	return eh.typed[gvk], nil
+}
+
+// decode the resource into the type registered with the scheme for its group, version and kind.
+func (eh *EventHandler) decode(obj *unstructured.Unstructured) (runtime.Object, error) {
+	typed, err := eh.scheme.New(obj.GroupVersionKind())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, typed); err != nil {
+		return nil, fmt.Errorf("failed to convert resource %s to %T: %w", obj.GetUID(), typed, err)
+	}
+
+	return typed, nil
+}
+
+func (eh *EventHandler) handleObjectCreated(ctx context.Context, clusterID string, obj *unstructured.Unstructured) error {
+	handlers, ok := eh.typed[obj.GroupVersionKind()]
+	if !ok || len(handlers.onObjectCreated) == 0 {
+		return nil
+	}
+
+	typed, err := eh.decode(obj)
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range handlers.onObjectCreated {
+		if err = fn(ctx, clusterID, typed); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (eh *EventHandler) handleObjectUpdated(ctx context.Context, clusterID string, then, now *unstructured.Unstructured) error {
+	handlers, ok := eh.typed[now.GroupVersionKind()]
+	if !ok || len(handlers.onObjectUpdated) == 0 {
+		return nil
+	}
+
+	typedThen, err := eh.decode(then)
+	if err != nil {
+		return err
+	}
+
+	typedNow, err := eh.decode(now)
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range handlers.onObjectUpdated {
+		if err = fn(ctx, clusterID, typedThen, typedNow); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// handleObjectDeleted invokes the ObjectDeletedHandler registered for the group, version and kind of the deleted
+// resource, which are taken from the event attributes as deleted events do not contain the resource.
+func (eh *EventHandler) handleObjectDeleted(ctx context.Context, evt event.Event, clusterID, resourceUID string) error {
+	gvk := schema.GroupVersionKind{
+		Group:   evt.Attributes[event.AttributeGroup],
+		Version: evt.Attributes[event.AttributeVersion],
+		Kind:    evt.Attributes[event.AttributeKind],
+	}
+
+	handlers, ok := eh.typed[gvk]
+	if !ok {
+		return nil
+	}
+
+	for _, fn := range handlers.onObjectDeleted {
+		if err := fn(ctx, clusterID, resourceUID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
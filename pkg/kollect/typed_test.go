@@ -0,0 +1,157 @@
+package kollect_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/davidsbond/kollect/internal/event"
+	"github.com/davidsbond/kollect/pkg/kollect"
+	resource "github.com/davidsbond/kollect/proto/kollect/resource/event/v1"
+)
+
+type (
+	// The Widget type is a custom resource used to test typed handlers.
+	Widget struct {
+		metav1.TypeMeta   `json:",inline"`
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+
+		Spec WidgetSpec `json:"spec"`
+	}
+
+	WidgetSpec struct {
+		Size int64 `json:"size"`
+	}
+)
+
+func (w *Widget) DeepCopyObject() runtime.Object {
+	out := *w
+	w.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	return &out
+}
+
+func TestEventHandler_HandleTyped(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	widgetGV := schema.GroupVersion{Group: "example.com", Version: "v1"}
+	sch := runtime.NewScheme()
+	require.NoError(t, scheme.AddToScheme(sch))
+	sch.AddKnownTypes(widgetGV, &Widget{})
+
+	writer, err := event.NewWriter(ctx, "mem://typed")
+	require.NoError(t, err)
+	defer writer.Close()
+
+	handler, err := kollect.NewEventHandler(ctx, "mem://typed", kollect.WithScheme(sch))
+	require.NoError(t, err)
+
+	var (
+		mux     sync.Mutex
+		handled []string
+	)
+
+	record := func(name string) {
+		mux.Lock()
+		defer mux.Unlock()
+
+		handled = append(handled, name)
+		if len(handled) == 4 {
+			cancel()
+		}
+	}
+
+	require.NoError(t, handler.OnObjectCreated(&appsv1.Deployment{}, func(ctx context.Context, clusterID string, obj runtime.Object) error {
+		deployment, ok := obj.(*appsv1.Deployment)
+		require.True(t, ok)
+		assert.Equal(t, "created", deployment.Name)
+		record("deployment created")
+		return nil
+	}))
+
+	require.NoError(t, handler.OnObjectUpdated(&appsv1.Deployment{}, func(ctx context.Context, clusterID string, then, now runtime.Object) error {
+		deployment, ok := now.(*appsv1.Deployment)
+		require.True(t, ok)
+		assert.Equal(t, "updated", deployment.Name)
+		assert.IsType(t, &appsv1.Deployment{}, then)
+		record("deployment updated")
+		return nil
+	}))
+
+	require.NoError(t, handler.OnObjectDeleted(&appsv1.Deployment{}, func(ctx context.Context, clusterID, resourceUID string) error {
+		assert.Equal(t, "deleted", resourceUID)
+		record("deployment deleted")
+		return nil
+	}))
+
+	require.NoError(t, handler.OnObjectCreated(&Widget{}, func(ctx context.Context, clusterID string, obj runtime.Object) error {
+		widget, ok := obj.(*Widget)
+		require.True(t, ok)
+		assert.EqualValues(t, 3, widget.Spec.Size)
+		record("widget created")
+		return nil
+	}))
+
+	// Types that are not known to the scheme cannot be registered.
+	assert.Error(t, handler.OnObjectCreated(&unstructured.Unstructured{}, nil))
+
+	widget := object("example.com/v1", "Widget", "default", "widget", nil)
+	require.NoError(t, unstructured.SetNestedField(widget.Object, int64(3), "spec", "size"))
+
+	events := []event.Event{
+		// Resources without a registered type should be ignored.
+		event.New(&resource.ResourceCreatedEvent{
+			Uid:       "pod",
+			Resource:  mustMarshal(t, object("v1", "Pod", "default", "pod", nil)),
+			ClusterId: "test",
+		}),
+		event.New(&resource.ResourceCreatedEvent{
+			Uid:       "created",
+			Resource:  mustMarshal(t, object("apps/v1", "Deployment", "default", "created", nil)),
+			ClusterId: "test",
+		}),
+		event.New(&resource.ResourceUpdatedEvent{
+			Uid:       "updated",
+			Then:      mustMarshal(t, object("apps/v1", "Deployment", "default", "updated", nil)),
+			Now:       mustMarshal(t, object("apps/v1", "Deployment", "default", "updated", nil)),
+			ClusterId: "test",
+		}),
+		event.New(&resource.ResourceDeletedEvent{
+			Uid:       "deleted",
+			ClusterId: "test",
+		}, event.WithAttributes(map[string]string{
+			event.AttributeGroup:   "apps",
+			event.AttributeVersion: "v1",
+			event.AttributeKind:    "Deployment",
+		})),
+		event.New(&resource.ResourceCreatedEvent{
+			Uid:       "widget",
+			Resource:  mustMarshal(t, widget),
+			ClusterId: "test",
+		}),
+	}
+
+	for _, evt := range events {
+		require.NoError(t, writer.Write(ctx, evt))
+	}
+
+	require.NoError(t, handler.Handle(ctx))
+	assert.ElementsMatch(t, []string{
+		"deployment created",
+		"deployment updated",
+		"deployment deleted",
+		"widget created",
+	}, handled)
+}
@@ -0,0 +1,12 @@
+package resource
+
+import (
+	// Used to embed the protobuf definition.
+	_ "embed"
+)
+
+// Schema contains the protobuf definition of the messages within this package. It is used when registering the
+// schema with a schema registry.
+//
+//go:embed event.proto
+var Schema string